@@ -0,0 +1,70 @@
+package dbmigrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Baseline records all migrations up to and including the one with the given version as applied without executing them,
+// so dbmigrate can be adopted on the existing database which schema has been created by other means.
+// Migrations are recorded as one batch and are flagged as baselined. Baseline refuses to run if some migrations
+// have already been applied, unless force is true, in which case only unapplied migrations are recorded
+func (m *Migrator) Baseline(version time.Time, force bool) (int, error) {
+	return m.BaselineContext(context.Background(), version, force)
+}
+
+// BaselineContext is the same as Baseline, but it can be cancelled using ctx
+func (m *Migrator) BaselineContext(ctx context.Context, version time.Time, force bool) (int, error) {
+	err := m.LockContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.Unlock()
+
+	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData(ctx, "version ASC")
+	if err != nil {
+		return 0, err
+	}
+	if len(appliedMigrationsData) > 0 && !force {
+		return 0, errors.Errorf("can't baseline, migrations table is not empty, applied migrations: %d", len(appliedMigrationsData))
+	}
+
+	migrations, err := m.migrationsToApplyTo(ctx, version)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+
+	batch, err := m.dbWrapper.lastBatch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	batch++
+
+	tx, err := m.dbWrapper.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't begin transaction")
+	}
+	defer tx.Rollback()
+
+	appliedAt := time.Now().UTC()
+	for _, migration := range migrations {
+		migration.AppliedAt = appliedAt
+		migration.Batch = batch
+		migration.Baselined = true
+		err = m.recordApplied(ctx, migration, tx)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, errors.Wrap(err, "can't commit baseline transaction")
+	}
+	return len(migrations), nil
+}
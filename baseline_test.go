@@ -0,0 +1,70 @@
+package dbmigrate
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Migrator_Baseline(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	v2 := time.Date(2018, 9, 18, 20, 6, 32, 0, time.UTC)
+	v3 := time.Date(2018, 9, 18, 20, 10, 19, 0, time.UTC)
+
+	_, err := m.Baseline(time.Date(2018, 9, 18, 20, 5, 0, 0, time.UTC), false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't find target migration")
+
+	n, err := m.Baseline(v2, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// migrations are recorded, but not executed
+	hasTable, _ := m.dbWrapper.hasTable(context.Background(), "posts")
+	assert.False(t, hasTable)
+
+	migrations, err := m.Status()
+	require.NoError(t, err)
+	for _, migration := range migrations {
+		if migration.Version.After(v2) {
+			assert.True(t, migration.AppliedAt.IsZero())
+			assert.False(t, migration.Baselined)
+			continue
+		}
+		assert.False(t, migration.AppliedAt.IsZero())
+		assert.Equal(t, 1, migration.Batch)
+		assert.True(t, migration.Baselined)
+	}
+
+	v, err := m.Verify()
+	require.NoError(t, err)
+	assert.False(t, v.HasDrift())
+
+	entries, err := m.History(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.True(t, entries[0].Manual)
+
+	_, err = m.Baseline(v3, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "migrations table is not empty")
+
+	n, err = m.Baseline(v3, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	lm, _ := m.LastAppliedMigration()
+	assert.Equal(t, v3, lm.Version)
+
+	n, err = m.Baseline(v3, true)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
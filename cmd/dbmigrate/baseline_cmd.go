@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// baselineFlags holds variables used for flags of baseline command
+var baselineFlags struct {
+	to    string
+	force bool
+}
+
+func init() {
+	baselineCmd.Flags().StringVar(&baselineFlags.to, "to", "", "version or name of the last migration to record as applied")
+	baselineCmd.Flags().BoolVar(&baselineFlags.force, "force", false, "record migrations even if the migrations table is not empty")
+}
+
+// baselineCmd is the Cobra command to record migrations as applied without executing them
+var baselineCmd = &cobra.Command{
+	Use:   "baseline",
+	Short: "Record migrations as applied without executing them",
+	Long: `Adopts dbmigrate on the existing database, which schema has been created by other means.
+All migrations up to and including the one given by --to flag, by its version or name, are recorded as applied
+in one batch and are flagged as baselined, but are not executed.
+Baseline refuses to run if the migrations table already has entries, unless --force flag is provided,
+in which case only not applied migrations are recorded.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := baseline(ctx, migrator, baselineFlags.to, baselineFlags.force)
+		return err
+	},
+}
+
+// baseline is the actual baseline function
+func baseline(ctx context.Context, migrator *dbmigrate.Migrator, to string, force bool) (int, error) {
+	if to == "" {
+		return 0, errors.New("can't baseline, --to flag is required")
+	}
+
+	version, err := migrator.ResolveVersion(to)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't baseline")
+	}
+
+	n, err := migrator.BaselineContext(ctx, version, force)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't baseline")
+	}
+	if n == 0 {
+		fmt.Println("there are no migrations to baseline")
+		return 0, nil
+	}
+	fmt.Printf("%d %s successfully baselined\n", n, pluralize("migration", n))
+
+	return n, nil
+}
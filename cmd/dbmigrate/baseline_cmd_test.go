@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_baseline(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
+		Engine: "sqlite", Database: "test.db",
+		Observer: &printObserver{},
+	})
+	defer migrator.Close()
+
+	_, err := baseline(context.Background(), migrator, "", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--to flag is required")
+
+	n, err := baseline(context.Background(), migrator, "second", false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	_, err = baseline(context.Background(), migrator, "third", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "migrations table is not empty")
+
+	n, err = baseline(context.Background(), migrator, "third", true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// baselined migrations are not applied by migrate
+	n, err = migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// dumpSchemaCmd is the Cobra command to dump the database schema next to the migrations
+var dumpSchemaCmd = &cobra.Command{
+	Use:   "dump-schema",
+	Short: "Dump the database schema",
+	Long: `Writes the schema of the database, i.e. its tables, indexes and views, sorted,
+and versions of applied migrations to the schema.<engine>.sql file in the migrations directory, i.e. the dbmigrations dir
+of the project or the directory given by --source flag,
+so changes of the schema made by migrations can be seen in diffs.
+Migrate and rollback commands dump the schema after they succeed if --dump-schema flag is provided.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := dumpSchema(ctx, migrator)
+		return err
+	},
+}
+
+// dumpSchema is the actual dump-schema function
+func dumpSchema(ctx context.Context, migrator *dbmigrate.Migrator) (string, error) {
+	fpath, err := migrator.DumpSchemaContext(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "can't dump schema")
+	}
+	fmt.Printf("schema has been dumped to %s\n", fpath)
+
+	return fpath, nil
+}
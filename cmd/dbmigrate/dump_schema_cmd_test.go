@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_dumpSchema(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
+		Engine: "sqlite", Database: "test.db",
+		Observer: &printObserver{},
+	})
+	defer migrator.Close()
+
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	fpath, err := dumpSchema(context.Background(), migrator)
+	require.NoError(t, err)
+
+	dump, _ := ioutil.ReadFile(fpath)
+	assert.Contains(t, string(dump), "CREATE TABLE users")
+	assert.Contains(t, string(dump), "INSERT INTO migrations (version) VALUES ('20180918201019');")
+
+	// the schema file is not a migration
+	n, err := migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
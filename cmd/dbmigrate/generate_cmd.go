@@ -15,10 +15,15 @@ const enginesNoOptDefVal = "currentengine"
 // migrationsGeneratorEngines used by flag which specifies database engines to create migrations for
 var migrationsGeneratorEngines []string
 
+// singleFile used by flag which specifies if up and down sections should be generated in one migration file
+var singleFile bool
+
 func init() {
-	generateCmd.Flags().StringSliceVarP(&migrationsGeneratorEngines, "engines", "g", nil, "specific engines")
+	generateCmd.Flags().StringSliceVarP(&migrationsGeneratorEngines, "engines", "g", nil,
+		"engines to create engine specific migrations for, all or some of "+strings.Join(dbmigrate.Engines(), ", ")+", without value the current engine is used")
 	// if flag is set without a value use this placeholder to later set specific engine to the one from migrator settings
 	generateCmd.Flags().Lookup("engines").NoOptDefVal = enginesNoOptDefVal
+	generateCmd.Flags().BoolVar(&singleFile, "single-file", false, "generate one file with up and down sections for each engine")
 }
 
 // generateCmd is the Cobra command to generate migrations
@@ -26,15 +31,16 @@ var generateCmd = &cobra.Command{
 	Use:   "generate",
 	Short: "Generate migration",
 	Long: `Generate up and down migrations, use args to build migration name,
-e.g. dbmigrate generate Create posts table will become create_posts_table in the generated migration name.`,
+e.g. dbmigrate generate Create posts table will become create_posts_table in the generated migration name.
+If --single-file flag is provided, one file with -- +migrate up and -- +migrate down sections is generated instead.`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return generateMigration(migrator, migrationsGeneratorEngines, args...)
+		return generateMigration(migrator, migrationsGeneratorEngines, singleFile, args...)
 	},
 }
 
 // generateMigration the the actual migration generation function
-func generateMigration(migrator *dbmigrate.Migrator, engines []string, args ...string) error {
+func generateMigration(migrator *dbmigrate.Migrator, engines []string, singleFile bool, args ...string) error {
 	if len(engines) == 1 && engines[0] == enginesNoOptDefVal {
 		engines[0] = migrator.Engine
 	}
@@ -43,7 +49,12 @@ func generateMigration(migrator *dbmigrate.Migrator, engines []string, args ...s
 		engines = dbmigrate.Engines()
 	}
 
-	fpaths, err := migrator.GenerateMigration(strings.Join(args, " "), engines...)
+	generateFn := migrator.GenerateMigration
+	if singleFile {
+		generateFn = migrator.GenerateSingleFileMigration
+	}
+
+	fpaths, err := generateFn(strings.Join(args, " "), engines...)
 	if err != nil {
 		return errors.Wrap(err, "can't generate migration")
 	}
@@ -17,23 +17,25 @@ func Test_generateMigration(t *testing.T) {
 	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{Engine: "sqlite", Database: "test.db"})
 	defer migrator.Close()
 
-	testFn := func(migrator *dbmigrate.Migrator, pattern string, len int, engines []string, args ...string) {
+	testFn := func(migrator *dbmigrate.Migrator, pattern string, len int, engines []string, singleFile bool, args ...string) {
 		os.Mkdir(dbmigrate.MigrationsDir, os.ModePerm)
-		err := generateMigration(migrator, engines, args...)
+		err := generateMigration(migrator, engines, singleFile, args...)
 		require.NoError(t, err)
 		matches, _ := filepath.Glob(filepath.Join(dbmigrate.MigrationsDir, pattern))
 		assert.Len(t, matches, len)
 		os.RemoveAll(dbmigrate.MigrationsDir)
 	}
 
-	testFn(migrator, "*first_migration.*.sql", 2, nil, "first", "migration")
-	testFn(migrator, "*first_migration.*.sql", 2, []string{}, "first", "migration")
-	testFn(migrator, "*current_engine_migration.*.sqlite.sql", 2, []string{enginesNoOptDefVal}, "current", "engine", "migration")
-	testFn(migrator, "*all_engines_migration.*.*.sql", 6, []string{"all"}, "all", "engines", "migration")
-	testFn(migrator, "*two_engines_migration.*.*.sql", 4, []string{"sqlite", "postgres"}, "two", "engines", "migration")
+	testFn(migrator, "*first_migration.*.sql", 2, nil, false, "first", "migration")
+	testFn(migrator, "*first_migration.*.sql", 2, []string{}, false, "first", "migration")
+	testFn(migrator, "*current_engine_migration.*.sqlite.sql", 2, []string{enginesNoOptDefVal}, false, "current", "engine", "migration")
+	testFn(migrator, "*all_engines_migration.*.*.sql", 6, []string{"all"}, false, "all", "engines", "migration")
+	testFn(migrator, "*two_engines_migration.*.*.sql", 4, []string{"sqlite", "postgres"}, false, "two", "engines", "migration")
+	testFn(migrator, "*single_file_migration.sql", 1, nil, true, "single", "file", "migration")
+	testFn(migrator, "*single_file_migration.*.sql", 2, []string{"sqlite", "postgres"}, true, "single", "file", "migration")
 
 	os.Mkdir(dbmigrate.MigrationsDir, os.ModePerm)
-	err := generateMigration(migrator, []string{"nodb"}, "wrong", "engine", "migration")
+	err := generateMigration(migrator, []string{"nodb"}, false, "wrong", "engine", "migration")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "is not exists/supported")
 	os.RemoveAll(dbmigrate.MigrationsDir)
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// historyFlags holds variables used for flags of history command
+var historyFlags struct {
+	migration string
+	since     string
+	until     string
+	output    string
+}
+
+func init() {
+	historyCmd.Flags().StringVar(&historyFlags.migration, "migration", "", "version or name of the migration to show history of")
+	historyCmd.Flags().StringVar(&historyFlags.since, "since", "", "show executions since the date or time, e.g. 2018-09-18 or '2018-09-18 20:04:53'")
+	historyCmd.Flags().StringVar(&historyFlags.until, "until", "", "show executions until the date (inclusive) or time (exclusive)")
+	historyCmd.Flags().StringVar(&historyFlags.output, "output", "table", "output format, table or json")
+}
+
+// historyCmd is the Cobra command that shows the history of migrations executions
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "History of migrations executions",
+	Long: `Shows every execution of migrations, successful or failed, in both directions, ordered by execution time.
+Unlike the status command, migrations which were applied and then rolled back are shown too.
+--migration flag filters executions of the migration specified by its version or name,
+--since and --until flags filter executions by date, e.g. 2018-09-18, or time in UTC, e.g. '2018-09-18 20:04:53'.
+Use --output json to get the machine readable output.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return history(ctx, migrator, historyFlags.migration, historyFlags.since, historyFlags.until, historyFlags.output)
+	},
+}
+
+// historyEntryJSON is the JSON representation of the history entry
+type historyEntryJSON struct {
+	ID               int       `json:"id"`
+	Version          string    `json:"version"`
+	Name             string    `json:"name"`
+	Direction        string    `json:"direction"`
+	ExecutedAt       time.Time `json:"executed_at"`
+	DurationMs       int64     `json:"duration_ms"`
+	Batch            int       `json:"batch"`
+	Manual           bool      `json:"manual"`
+	Error            string    `json:"error,omitempty"`
+	ExecutedBy       string    `json:"executed_by"`
+	Host             string    `json:"host"`
+	DbmigrateVersion string    `json:"dbmigrate_version"`
+}
+
+// history is the actual history function
+func history(ctx context.Context, migrator *dbmigrate.Migrator, migration, since, until, output string) error {
+	if output != "table" && output != "json" {
+		return errors.Errorf("unknown output format %s, should be table or json", output)
+	}
+
+	filter := &dbmigrate.HistoryFilter{}
+	var err error
+	if migration != "" {
+		// applied migrations could be removed since then, so the version is not checked to exist
+		filter.Version, err = time.Parse(dbmigrate.TimestampFormat, migration)
+		if err != nil {
+			filter.Version, err = migrator.ResolveVersion(migration)
+			if err != nil {
+				return errors.Wrap(err, "can't get history")
+			}
+		}
+	}
+	if since != "" {
+		filter.Since, err = parseHistoryTime(since, false)
+		if err != nil {
+			return errors.Wrap(err, "can't parse --since flag")
+		}
+	}
+	if until != "" {
+		filter.Until, err = parseHistoryTime(until, true)
+		if err != nil {
+			return errors.Wrap(err, "can't parse --until flag")
+		}
+	}
+
+	entries, err := migrator.HistoryContext(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		return printHistoryJSON(entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No migrations were executed yet")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "Version", "Name", "Direction", "Executed at", "Duration", "Batch", "Executed by", "Result"})
+	table.SetAutoWrapText(false)
+	for _, entry := range entries {
+		result := "ok"
+		switch {
+		case entry.Failed():
+			result = "failed: " + entry.Error
+		case entry.Manual:
+			result = "marked manually"
+		}
+		table.Append([]string{
+			strconv.Itoa(entry.ID), entry.Version.Format(dbmigrate.TimestampFormat), entry.Name, entry.Direction.String(),
+			entry.ExecutedAt.Format(dbmigrate.PrintTimestampFormat), entry.Duration.String(), strconv.Itoa(entry.Batch),
+			entry.ExecutedBy + "@" + entry.Host, result,
+		})
+	}
+	table.Render()
+
+	return nil
+}
+
+// printHistoryJSON prints history entries as JSON array
+func printHistoryJSON(entries []*dbmigrate.HistoryEntry) error {
+	jsonEntries := make([]*historyEntryJSON, len(entries))
+	for i, entry := range entries {
+		jsonEntries[i] = &historyEntryJSON{
+			ID: entry.ID, Version: entry.Version.Format(dbmigrate.TimestampFormat), Name: entry.Name, Direction: entry.Direction.String(),
+			ExecutedAt: entry.ExecutedAt, DurationMs: int64(entry.Duration / time.Millisecond), Batch: entry.Batch, Manual: entry.Manual,
+			Error: entry.Error, ExecutedBy: entry.ExecutedBy, Host: entry.Host, DbmigrateVersion: entry.DbmigrateVersion,
+		}
+	}
+
+	data, err := json.MarshalIndent(jsonEntries, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "can't encode history to JSON")
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// parseHistoryTime parses the date or the time in UTC, the date used as the end of the range includes the whole day
+func parseHistoryTime(s string, end bool) (time.Time, error) {
+	t, err := time.Parse("2006-01-02 15:04:05", s)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, errors.Errorf("%s is neither date nor time, should be e.g. 2018-09-18 or '2018-09-18 20:04:53'", s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_history(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
+		Engine: "sqlite", Database: "test.db",
+		Observer: &printObserver{},
+	})
+	defer migrator.Close()
+
+	historyWrapper := func(migration, since, until, output string) (string, error) {
+		old := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+		err := history(context.Background(), migrator, migration, since, until, output)
+
+		resultCh := make(chan string)
+		go func() {
+			var b bytes.Buffer
+			io.Copy(&b, r)
+			r.Close()
+			resultCh <- b.String()
+		}()
+		os.Stdout = old
+		w.Close()
+		return <-resultCh, err
+	}
+
+	out, err := historyWrapper("", "", "", "table")
+	require.NoError(t, err)
+	assert.Contains(t, out, "No migrations were executed yet")
+
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	rollback(context.Background(), migrator, 1, "", 0)
+
+	out, err = historyWrapper("", "", "", "table")
+	require.NoError(t, err)
+	assert.Contains(t, out, "20180918200453")
+	assert.Contains(t, out, "down")
+
+	out, err = historyWrapper("first", "", "", "json")
+	require.NoError(t, err)
+	var entries []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "20180918200453", entries[0]["version"])
+	assert.Equal(t, "up", entries[0]["direction"])
+
+	out, err = historyWrapper("", time.Now().UTC().Format("2006-01-02"), time.Now().UTC().Format("2006-01-02"), "json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(out), &entries))
+	assert.Len(t, entries, 4)
+
+	_, err = historyWrapper("", "yesterday", "", "table")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't parse --since flag")
+
+	_, err = historyWrapper("", "", "", "xml")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown output format xml")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// markCmd is the Cobra command to record the migration as applied without executing it
+var markCmd = &cobra.Command{
+	Use:   "mark <version or name>",
+	Short: "Mark migration as applied without executing it",
+	Long: `Records the migration, specified by its version or name, as applied without executing it,
+e.g. if its changes have been made by hand. The migration is recorded as a new batch
+and the manual action is added to the history.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return mark(ctx, migrator, args[0])
+	},
+}
+
+// unmarkCmd is the Cobra command to remove the migration from applied ones without rolling it back
+var unmarkCmd = &cobra.Command{
+	Use:   "unmark <version or name>",
+	Short: "Mark migration as not applied without rolling it back",
+	Long: `Removes the migration, specified by its version or name, from applied ones without rolling it back,
+e.g. if it failed half way on the database without transactional DDL and its changes have been reverted by hand.
+The manual action is added to the history.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return unmark(ctx, migrator, args[0])
+	},
+}
+
+// mark is the actual mark function
+func mark(ctx context.Context, migrator *dbmigrate.Migrator, migration string) error {
+	version, err := migrator.ResolveVersion(migration)
+	if err != nil {
+		return errors.Wrap(err, "can't mark migration as applied")
+	}
+
+	err = migrator.MarkAppliedContext(ctx, version)
+	if err != nil {
+		return errors.Wrap(err, "can't mark migration as applied")
+	}
+	fmt.Printf("migration with version %s has been marked as applied\n", version.Format(dbmigrate.TimestampFormat))
+
+	return nil
+}
+
+// unmark is the actual unmark function
+func unmark(ctx context.Context, migrator *dbmigrate.Migrator, migration string) error {
+	version, err := migrator.ResolveVersion(migration)
+	if err != nil {
+		return errors.Wrap(err, "can't mark migration as not applied")
+	}
+
+	err = migrator.MarkUnappliedContext(ctx, version)
+	if err != nil {
+		return errors.Wrap(err, "can't mark migration as not applied")
+	}
+	fmt.Printf("migration with version %s has been marked as not applied\n", version.Format(dbmigrate.TimestampFormat))
+
+	return nil
+}
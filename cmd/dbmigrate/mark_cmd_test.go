@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_mark_unmark(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
+		Engine: "sqlite", Database: "test.db",
+		Observer: &printObserver{},
+	})
+	defer migrator.Close()
+
+	err := mark(context.Background(), migrator, "nonexistent")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't mark migration as applied")
+
+	require.NoError(t, mark(context.Background(), migrator, "second"))
+	err = mark(context.Background(), migrator, "second")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already applied")
+
+	// the marked migration is skipped by migrate
+	n, err := migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	require.NoError(t, unmark(context.Background(), migrator, "20180918200632"))
+	err = unmark(context.Background(), migrator, "second")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not applied")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/dafanasev/dbmigrate"
@@ -10,6 +11,9 @@ import (
 
 func init() {
 	migrateCmd.Flags().IntVarP(&steps, "steps", "s", 0, "steps")
+	migrateCmd.Flags().StringVar(&to, "to", "", "version or name of the migration to migrate up to")
+	migrateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would be executed without changing the database")
+	migrateCmd.Flags().BoolVar(&withSchemaDump, "dump-schema", false, "dump the database schema to the migrations directory after migrating")
 }
 
 // migrateCmd is the root Cobra command, used to migrate database schema
@@ -18,35 +22,45 @@ var migrateCmd = &cobra.Command{
 	Short: "Apply migrations",
 	Long: `Migrate database schema.
 By default, all unapplied migrations will be applied.
-If --steps (-s) flag is provided, only -s migrations will.`,
+If --steps (-s) flag is provided, only -s migrations will.
+If --to flag is provided, migrations up to and including the given one will be applied,
+the migration can be specified by its version or name.
+If --dry-run flag is provided, migrations and their statements are printed instead of being executed.
+If --dump-schema flag is provided, the database schema is dumped to the migrations directory after migrating.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		_, err := migrate(migrator, steps)
+		if dryRun {
+			_, err := plan(ctx, migrator, dbmigrate.DirectionUp, steps, to, 0)
+			return err
+		}
+		_, err := migrate(ctx, migrator, steps, to)
+		if err != nil || !withSchemaDump {
+			return err
+		}
+		_, err = dumpSchema(ctx, migrator)
 		return err
 	},
 }
 
 // migrate is the actual migration function
-func migrate(migrator *dbmigrate.Migrator, steps int) (int, error) {
-	done := make(chan struct{})
-	gdone := make(chan struct{})
-
-	go func() {
-		for {
-			select {
-			case migration := <-migrator.MigrationsCh:
-				fmt.Printf("migration %s has been successfully applied\n", migration.FileName())
-			case <-done:
-				close(gdone)
-				return
-			}
+func migrate(ctx context.Context, migrator *dbmigrate.Migrator, steps int, to string) (int, error) {
+	migrateFn := func() (int, error) {
+		return migrator.MigrateContext(ctx, steps)
+	}
+	if to != "" {
+		version, err := targetVersion(migrator, steps, to)
+		if err != nil {
+			return 0, errors.Wrap(err, "can't migrate")
 		}
-	}()
-
-	n, err := migrator.MigrateSteps(steps)
-	close(done)
+		migrateFn = func() (int, error) {
+			return migrator.MigrateToContext(ctx, version)
+		}
+	}
 
-	<-gdone
+	n, err := migrateFn()
 	if err != nil {
+		if ctx.Err() != nil {
+			return n, errors.Wrap(err, "migrate has been interrupted")
+		}
 		return n, errors.Wrap(err, "can't migrate")
 	}
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -18,22 +19,49 @@ func Test_migrate(t *testing.T) {
 
 	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
 		Engine: "sqlite", Database: "test.db",
-		MigrationsCh: make(chan *dbmigrate.Migration), ErrorsCh: make(chan error),
+		Observer: &printObserver{},
 	})
 	defer migrator.Close()
 
-	n, err := migrate(migrator, dbmigrate.AllSteps)
+	n, err := migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
 	require.NoError(t, err)
 	assert.Equal(t, 3, n)
 
-	n, err = migrate(migrator, dbmigrate.AllSteps)
+	n, err = migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
 	require.NoError(t, err)
 	assert.Zero(t, n)
 
 	ioutil.WriteFile(filepath.Join(dbmigrate.MigrationsDir, "20180918202020.error.up.sqlite.sql"), []byte("error"), os.ModePerm)
-	_, err = migrate(migrator, dbmigrate.AllSteps)
+	_, err = migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "can't migrate")
 	os.Remove(filepath.Join(dbmigrate.MigrationsDir, "20180918202020.error.up.sqlite.sql"))
 
 }
+
+func Test_migrate_to(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
+		Engine: "sqlite", Database: "test.db",
+		Observer: &printObserver{},
+	})
+	defer migrator.Close()
+
+	_, err := migrate(context.Background(), migrator, 1, "second")
+	assert.EqualError(t, err, "can't migrate: --steps and --to flags can't be used together")
+
+	_, err = migrate(context.Background(), migrator, dbmigrate.AllSteps, "fourth")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "migration with name fourth does not exist")
+
+	n, err := migrate(context.Background(), migrator, dbmigrate.AllSteps, "second")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = migrate(context.Background(), migrator, dbmigrate.AllSteps, "20180918201019")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
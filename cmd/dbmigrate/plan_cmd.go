@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// planDirection variable, used for the direction flag of plan command
+var planDirection string
+
+func init() {
+	planCmd.Flags().StringVar(&planDirection, "direction", dbmigrate.DirectionUp.String(), "direction of the planned operation, up (migrate) or down (rollback)")
+	planCmd.Flags().IntVarP(&steps, "steps", "s", 0, "steps")
+	planCmd.Flags().StringVar(&to, "to", "", "version or name of the target migration")
+	planCmd.Flags().IntVar(&batch, "batch", 0, "number of the migrate operation (batch) to plan rollback of")
+}
+
+// planCmd is the Cobra command that shows what migrate or rollback would execute
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show what migrate or rollback would execute",
+	Long: `Show migrations, in the order they would be run, and the statements they consist of,
+including changes of the migrations and history tables, without changing the database.
+By default, migrate operation is planned, use --direction down to plan rollback.
+--steps (-s), --to and --batch flags have the same meaning as for migrate and rollback commands.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		direction, err := dbmigrate.DirectionFromString(planDirection)
+		if err != nil {
+			return errors.Wrap(err, "can't plan")
+		}
+		_, err = plan(ctx, migrator, direction, steps, to, batch)
+		return err
+	},
+}
+
+// plan is the actual plan function, it is also used by migrate and rollback commands with --dry-run flag
+func plan(ctx context.Context, migrator *dbmigrate.Migrator, direction dbmigrate.Direction, steps int, to string, batch int) (int, error) {
+	p, err := buildPlan(ctx, migrator, direction, steps, to, batch)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't plan")
+	}
+
+	printPlan(p)
+	return len(p.Steps), nil
+}
+
+// planReapply prints what reapply command would execute, i.e. rollback plan followed by its reversed plan
+func planReapply(ctx context.Context, migrator *dbmigrate.Migrator, steps int, to string) (int, error) {
+	rollbackPlan, err := buildPlan(ctx, migrator, dbmigrate.DirectionDown, steps, to, 0)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't plan reapply")
+	}
+	if len(rollbackPlan.Steps) == 0 {
+		fmt.Println("there are no migrations to reapply")
+		return 0, nil
+	}
+
+	migratePlan, err := migrator.ReversePlan(rollbackPlan)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't plan reapply")
+	}
+
+	printPlan(rollbackPlan)
+	printPlan(migratePlan)
+	return len(migratePlan.Steps), nil
+}
+
+// buildPlan returns the plan for steps, for the migration specified by to or for the batch
+func buildPlan(ctx context.Context, migrator *dbmigrate.Migrator, direction dbmigrate.Direction, steps int, to string, batch int) (*dbmigrate.Plan, error) {
+	if batch != 0 {
+		if direction != dbmigrate.DirectionDown {
+			return nil, errors.New("--batch flag can be used only with down direction")
+		}
+		err := checkBatchFlag(steps, to)
+		if err != nil {
+			return nil, err
+		}
+		return migrator.PlanBatchContext(ctx, batch)
+	}
+	if to == "" {
+		return migrator.PlanContext(ctx, direction, steps)
+	}
+
+	version, err := targetVersion(migrator, steps, to)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.PlanToContext(ctx, direction, version)
+}
+
+// printPlan prints migrations of the plan, each one followed by its statements
+func printPlan(p *dbmigrate.Plan) {
+	operation, verb := "migrate", "apply"
+	if p.Direction == dbmigrate.DirectionDown {
+		operation, verb = "rollback", "rollback"
+	}
+
+	if len(p.Steps) == 0 {
+		fmt.Printf("there are no migrations to %s\n", verb)
+		return
+	}
+
+	fmt.Printf("-- %s plan, %d %s\n", operation, len(p.Steps), pluralize("migration", len(p.Steps)))
+	for _, step := range p.Steps {
+		fmt.Println()
+		switch {
+		case len(step.Statements) == 0:
+			fmt.Printf("-- %s is empty and will be skipped\n", step.Migration.FileName())
+			continue
+		case !step.Transactional:
+			fmt.Printf("-- %s (without transaction)\n", step.Migration.FileName())
+		default:
+			fmt.Printf("-- %s\n", step.Migration.FileName())
+			fmt.Println("BEGIN;")
+			if step.Migration.Go {
+				fmt.Println("-- Go function")
+			}
+		}
+		for _, statement := range step.Statements {
+			fmt.Printf("%s;\n", statement)
+		}
+		if step.Transactional {
+			fmt.Println("COMMIT;")
+		}
+	}
+	fmt.Println()
+}
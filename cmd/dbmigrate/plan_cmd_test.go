@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_plan(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
+		Engine: "sqlite", Database: "test.db",
+		Observer: &printObserver{},
+	})
+	defer migrator.Close()
+
+	n, err := plan(context.Background(), migrator, dbmigrate.DirectionUp, dbmigrate.AllSteps, "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	n, err = plan(context.Background(), migrator, dbmigrate.DirectionUp, 0, "second", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	_, err = plan(context.Background(), migrator, dbmigrate.DirectionUp, 1, "second", 0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--steps and --to flags can't be used together")
+
+	n, err = plan(context.Background(), migrator, dbmigrate.DirectionDown, 0, "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = planReapply(context.Background(), migrator, 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+
+	n, err = plan(context.Background(), migrator, dbmigrate.DirectionDown, 0, "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	n, err = planReapply(context.Background(), migrator, 0, "first")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// dry run doesn't change the database
+	lm, _ := migrator.LatestVersionMigration()
+	assert.Equal(t, "third", lm.Name)
+}
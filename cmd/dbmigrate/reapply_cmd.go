@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"os"
 
 	"github.com/dafanasev/dbmigrate"
 	"github.com/pkg/errors"
@@ -11,6 +11,8 @@ import (
 
 func init() {
 	reapplyCmd.Flags().IntVarP(&steps, "steps", "s", 0, "steps")
+	reapplyCmd.Flags().StringVar(&to, "to", "", "version or name of the migration after which migrations will be reapplied")
+	reapplyCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would be executed without changing the database")
 }
 
 // reapplyCmd is the Cobra command to reapply last migration operation or specified number of migrations
@@ -19,54 +21,59 @@ var reapplyCmd = &cobra.Command{
 	Short: "Reapply migrations",
 	Long: `Rollback migrations.
 The latest migration operation will be reapplied, e.g. if 3 migrations have been applied, 3 migrations will be rolled back and reapplied.
-If --steps (-s) flag is provided, -s migrations will be reapplied.`,
+If --steps (-s) flag is provided, -s migrations will be reapplied.
+If --to flag is provided, all migrations applied after the given one will be reapplied,
+the migration can be specified by its version or name.
+If --dry-run flag is provided, migrations and their statements are printed instead of being executed.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		_, err := reapply(migrator, steps)
+		if dryRun {
+			_, err := planReapply(ctx, migrator, steps, to)
+			return err
+		}
+		_, err := reapply(ctx, migrator, steps, to)
 		return err
 	},
 }
 
 // reapply is the actual reapply function
-func reapply(migrator *dbmigrate.Migrator, steps int) (int, error) {
-	done := make(chan struct{})
-	gdone := make(chan struct{})
+func reapply(ctx context.Context, migrator *dbmigrate.Migrator, steps int, to string) (int, error) {
+	// hold the lock during both rollback and migrate, so no one can migrate in between
+	err := migrator.LockContext(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't reapply")
+	}
+	defer migrator.Unlock()
 
-	go func() {
-		for {
-			select {
-			case err := <-migrator.ErrorsCh:
-				fmt.Fprintln(os.Stderr, errors.Wrap(err, "migration error"))
-			case migration := <-migrator.MigrationsCh:
-				switch migration.Direction {
-				case dbmigrate.DirectionUp:
-					fmt.Printf("migration %s has been successfully applied\n", migration.FileName())
-				case dbmigrate.DirectionDown:
-					fmt.Printf("migration %s has been successfully rolled back\n", migration.FileName())
-				}
-			case <-done:
-				close(gdone)
-				return
-			}
+	rollbackFn := func() (int, error) {
+		return migrator.RollbackContext(ctx, steps)
+	}
+	if to != "" {
+		version, err := targetVersion(migrator, steps, to)
+		if err != nil {
+			return 0, errors.Wrap(err, "can't reapply")
+		}
+		rollbackFn = func() (int, error) {
+			return migrator.RollbackToContext(ctx, version)
 		}
-	}()
+	}
 
-	n, err := migrator.RollbackSteps(steps)
+	n, err := rollbackFn()
 	if err != nil {
-		close(done)
+		if ctx.Err() != nil {
+			return n, errors.Wrap(err, "reapply has been interrupted during rollback")
+		}
 		return n, errors.Wrap(err, "can't reapply: can't rollback")
 	}
 	if n == 0 {
-		close(done)
-		<-gdone
 		fmt.Println("there are no migrations to reapply")
 		return n, nil
 	}
 
-	n, err = migrator.MigrateSteps(n)
-	close(done)
-
-	<-gdone
+	n, err = migrator.MigrateContext(ctx, n)
 	if err != nil {
+		if ctx.Err() != nil {
+			return n, errors.Wrap(err, "reapply has been interrupted during migrate")
+		}
 		return n, errors.Wrap(err, "can't reapply: can't migrate")
 	}
 	fmt.Printf("%d %s successfully reapplied\n", n, pluralize("migration", n))
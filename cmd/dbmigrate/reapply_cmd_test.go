@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -17,34 +18,57 @@ func Test_reapply(t *testing.T) {
 
 	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
 		Engine: "sqlite", Database: "test.db",
-		MigrationsCh: make(chan *dbmigrate.Migration), ErrorsCh: make(chan error),
+		Observer: &printObserver{},
 	})
 	defer migrator.Close()
 
-	n, err := reapply(migrator, 0)
+	n, err := reapply(context.Background(), migrator, 0, "")
 	require.NoError(t, err)
 	assert.Equal(t, 0, n)
 
-	migrate(migrator, dbmigrate.AllSteps)
-	n, err = reapply(migrator, 0)
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	n, err = reapply(context.Background(), migrator, 0, "")
 	require.NoError(t, err)
 	assert.Equal(t, 3, n)
 
-	migrate(migrator, dbmigrate.AllSteps)
-	n, err = reapply(migrator, 2)
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	n, err = reapply(context.Background(), migrator, 2, "")
 	require.NoError(t, err)
 	assert.Equal(t, 2, n)
 
+	// the last batch consists of the second and third migrations, so rollback of the first one is requested by steps
 	os.Rename(filepath.Join(dbmigrate.MigrationsDir, "20180918200453.first.down.sql"), "./20180918200453.first.down.sql")
-	n, err = reapply(migrator, 0)
+	n, err = reapply(context.Background(), migrator, 3, "")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "can't rollback")
 	assert.Equal(t, 0, n)
 
-	migrate(migrator, dbmigrate.AllSteps)
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
 	migrator.AllowMissingDowns = true
-	n, err = reapply(migrator, 0)
+	n, err = reapply(context.Background(), migrator, 0, "")
 	require.NoError(t, err)
 	assert.Equal(t, 2, n)
 	os.Rename("./20180918200453.first.down.sql", filepath.Join(dbmigrate.MigrationsDir, "20180918200453.first.down.sql"))
 }
+
+func Test_reapply_to(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
+		Engine: "sqlite", Database: "test.db",
+		Observer: &printObserver{},
+	})
+	defer migrator.Close()
+
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+
+	n, err := reapply(context.Background(), migrator, 0, "second")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = reapply(context.Background(), migrator, 0, "first")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// repairFlags holds variables used for flags of repair command
+var repairFlags struct {
+	resume bool
+	clear  bool
+}
+
+func init() {
+	repairCmd.Flags().BoolVar(&repairFlags.resume, "resume", false, "resume the partially executed migration from the failed statement")
+	repairCmd.Flags().BoolVar(&repairFlags.clear, "clear", false, "clear the dirty state after the database has been fixed manually")
+}
+
+// repairCmd is the Cobra command to fix the dirty state left by the partially executed migration
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Repair partially executed migration",
+	Long: `Fixes the dirty state left by the migration which failed after some of its statements had been executed
+and can't be rolled back, because the migration is not transactional or the engine, e.g. mysql, commits DDL implicitly.
+While the database is dirty, migrate, rollback and reapply commands refuse to run.
+Without flags the dirty state is shown. --resume flag executes the migration from the failed statement,
+e.g. after the migration file has been fixed, --clear flag clears the dirty state after the database has been fixed manually.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return repair(ctx, migrator, repairFlags.resume, repairFlags.clear)
+	},
+}
+
+// repair is the actual repair function
+func repair(ctx context.Context, migrator *dbmigrate.Migrator, resume bool, clear bool) error {
+	if resume && clear {
+		return errors.New("--resume and --clear flags can't be used together")
+	}
+
+	dirty, err := migrator.DirtyContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "can't repair")
+	}
+	if dirty == nil {
+		fmt.Println("database is not dirty, there is nothing to repair")
+		return nil
+	}
+	fmt.Printf("%s migration with version %s failed after %d %s had been executed\n", dirty.Direction,
+		dirty.Version.Format(dbmigrate.TimestampFormat), dirty.ExecutedStatements, pluralize("statement", dirty.ExecutedStatements))
+
+	if !resume && !clear {
+		fmt.Println("use --resume flag to resume it or --clear flag to clear the dirty state after fixing the database manually")
+		return nil
+	}
+
+	err = migrator.RepairContext(ctx, resume)
+	if err != nil {
+		return errors.Wrap(err, "can't repair")
+	}
+	if resume {
+		fmt.Println("migration has been successfully resumed")
+	} else {
+		fmt.Println("dirty state has been cleared")
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_repair(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
+		Engine: "sqlite", Database: "test.db",
+		Observer: &printObserver{},
+	})
+	defer migrator.Close()
+
+	require.NoError(t, repair(context.Background(), migrator, false, false))
+	err := repair(context.Background(), migrator, true, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't be used together")
+
+	fpath := filepath.Join(dbmigrate.MigrationsDir, "20180918202020.no_transaction.up.sql")
+	ioutil.WriteFile(fpath, []byte("-- dbmigrate:no-transaction\nCREATE TABLE logs (message TEXT);\nERROR;"), os.ModePerm)
+	_, err = migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	require.Error(t, err)
+
+	// showing the dirty state doesn't change it
+	require.NoError(t, repair(context.Background(), migrator, false, false))
+	_, err = migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database is dirty")
+
+	ioutil.WriteFile(fpath, []byte("-- dbmigrate:no-transaction\nCREATE TABLE logs (message TEXT);\nCREATE TABLE events (name TEXT);"), os.ModePerm)
+	require.NoError(t, repair(context.Background(), migrator, true, false))
+	dirty, _ := migrator.Dirty()
+	assert.Nil(t, dirty)
+	n, err := migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"os"
 
 	"github.com/dafanasev/dbmigrate"
 	"github.com/pkg/errors"
@@ -11,6 +11,10 @@ import (
 
 func init() {
 	rollbackCmd.Flags().IntVarP(&steps, "steps", "s", 0, "steps")
+	rollbackCmd.Flags().StringVar(&to, "to", "", "version or name of the migration to roll back to")
+	rollbackCmd.Flags().IntVar(&batch, "batch", 0, "number of the migrate operation (batch) to roll back")
+	rollbackCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would be executed without changing the database")
+	rollbackCmd.Flags().BoolVar(&withSchemaDump, "dump-schema", false, "dump the database schema to the migrations directory after rolling back")
 }
 
 // rollbackCmd is the Cobra command to rollback migrations
@@ -19,37 +23,55 @@ var rollbackCmd = &cobra.Command{
 	Short: "Rollback migrations",
 	Long: `Rollback migrations.
 The latest migration operation will be rolled back, e.g. if 3 migrations have been applied, 3 migrations will be rolled back.
-If --steps (-s) flag is provided, -s migrations will be rolled back.`,
+If --steps (-s) flag is provided, -s migrations will be rolled back.
+If --to flag is provided, all migrations applied after the given one will be rolled back,
+the migration can be specified by its version or name.
+If --batch flag is provided, migrations applied during the migrate operation with the given number will be rolled back,
+batch numbers are shown by the status command.
+If --dry-run flag is provided, migrations and their statements are printed instead of being executed.
+If --dump-schema flag is provided, the database schema is dumped to the migrations directory after rolling back.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		_, err := rollback(migrator, steps)
+		if dryRun {
+			_, err := plan(ctx, migrator, dbmigrate.DirectionDown, steps, to, batch)
+			return err
+		}
+		_, err := rollback(ctx, migrator, steps, to, batch)
+		if err != nil || !withSchemaDump {
+			return err
+		}
+		_, err = dumpSchema(ctx, migrator)
 		return err
 	},
 }
 
 // rollback is the actual rollback function
-func rollback(migrator *dbmigrate.Migrator, steps int) (int, error) {
-	done := make(chan struct{})
-	gdone := make(chan struct{})
-
-	go func() {
-		for {
-			select {
-			case err := <-migrator.ErrorsCh:
-				fmt.Fprintln(os.Stderr, errors.Wrap(err, "rollback error"))
-			case migration := <-migrator.MigrationsCh:
-				fmt.Printf("migration %s has been successfully rolled back\n", migration.FileName())
-			case <-done:
-				close(gdone)
-				return
-			}
+func rollback(ctx context.Context, migrator *dbmigrate.Migrator, steps int, to string, batch int) (int, error) {
+	rollbackFn := func() (int, error) {
+		return migrator.RollbackContext(ctx, steps)
+	}
+	if batch != 0 {
+		err := checkBatchFlag(steps, to)
+		if err != nil {
+			return 0, errors.Wrap(err, "can't rollback")
 		}
-	}()
-
-	n, err := migrator.RollbackSteps(steps)
-	close(done)
+		rollbackFn = func() (int, error) {
+			return migrator.RollbackBatchContext(ctx, batch)
+		}
+	} else if to != "" {
+		version, err := targetVersion(migrator, steps, to)
+		if err != nil {
+			return 0, errors.Wrap(err, "can't rollback")
+		}
+		rollbackFn = func() (int, error) {
+			return migrator.RollbackToContext(ctx, version)
+		}
+	}
 
-	<-gdone
+	n, err := rollbackFn()
 	if err != nil {
+		if ctx.Err() != nil {
+			return n, errors.Wrap(err, "rollback has been interrupted")
+		}
 		return n, errors.Wrap(err, "can't rollback")
 	}
 
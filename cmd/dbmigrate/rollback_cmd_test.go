@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -17,37 +18,86 @@ func Test_rollback(t *testing.T) {
 
 	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
 		Engine: "sqlite", Database: "test.db",
-		MigrationsCh: make(chan *dbmigrate.Migration), ErrorsCh: make(chan error),
+		Observer: &printObserver{},
 	})
 	defer migrator.Close()
 
-	migrate(migrator, dbmigrate.AllSteps)
-	n, err := rollback(migrator, 0)
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	n, err := rollback(context.Background(), migrator, 0, "", 0)
 	require.NoError(t, err)
 	assert.Equal(t, 3, n)
 
-	migrate(migrator, dbmigrate.AllSteps)
-	n, err = rollback(migrator, 1)
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	n, err = rollback(context.Background(), migrator, 1, "", 0)
 	require.NoError(t, err)
 	assert.Equal(t, 1, n)
-	n, err = rollback(migrator, 0)
+	n, err = rollback(context.Background(), migrator, 0, "", 0)
 	require.NoError(t, err)
 	assert.Equal(t, 2, n)
-	n, err = rollback(migrator, 0)
+	n, err = rollback(context.Background(), migrator, 0, "", 0)
 	require.NoError(t, err)
 	assert.Equal(t, 0, n)
 
 	os.Rename(filepath.Join(dbmigrate.MigrationsDir, "20180918200453.first.down.sql"), "./20180918200453.first.down.sql")
-	migrate(migrator, dbmigrate.AllSteps)
-	n, err = rollback(migrator, 0)
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	n, err = rollback(context.Background(), migrator, 0, "", 0)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "can't rollback")
 	assert.Equal(t, 0, n)
 
-	migrate(migrator, dbmigrate.AllSteps)
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
 	migrator.AllowMissingDowns = true
-	n, err = rollback(migrator, 0)
+	n, err = rollback(context.Background(), migrator, 0, "", 0)
 	require.NoError(t, err)
 	assert.Equal(t, 2, n)
 	os.Rename("./20180918200453.first.down.sql", filepath.Join(dbmigrate.MigrationsDir, "20180918200453.first.down.sql"))
 }
+
+func Test_rollback_to(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
+		Engine: "sqlite", Database: "test.db",
+		Observer: &printObserver{},
+	})
+	defer migrator.Close()
+
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+
+	_, err := rollback(context.Background(), migrator, 0, "20180918201020", 0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "migration with version 20180918201020 does not exist")
+
+	n, err := rollback(context.Background(), migrator, 0, "first", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func Test_rollback_batch(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
+		Engine: "sqlite", Database: "test.db",
+		Observer: &printObserver{},
+	})
+	defer migrator.Close()
+
+	migrate(context.Background(), migrator, 1, "")
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+
+	_, err := rollback(context.Background(), migrator, 1, "", 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--batch flag can't be used together with --steps or --to flags")
+
+	_, err = rollback(context.Background(), migrator, 0, "", 3)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "batch 3 does not exist")
+
+	n, err := rollback(context.Background(), migrator, 0, "", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
@@ -1,90 +1,263 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dafanasev/dbmigrate"
 	"github.com/olekukonko/tablewriter"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
+// exit codes of status command with --check flag, 1 is used for all other errors
+const (
+	exitCodePending         = 2
+	exitCodeUnknownVersions = 3
+	exitCodeConnection      = 4
+	exitCodeDirty           = 5
+)
+
+// statusFlags holds variables used for flags of status command
+var statusFlags struct {
+	output string
+	check  bool
+}
+
+func init() {
+	statusCmd.Flags().StringVar(&statusFlags.output, "output", "table", "output format, table, json or yaml")
+	statusCmd.Flags().BoolVar(&statusFlags.check, "check", false,
+		fmt.Sprintf("exit with code %d if there are pending migrations, %d if there are applied migrations without files, "+
+			"%d if the database can't be queried and %d if the database is dirty",
+			exitCodePending, exitCodeUnknownVersions, exitCodeConnection, exitCodeDirty))
+}
+
 // statusCmd is the Cobra command that shows status of all migrations, if they were applied and when
 // also it shows latest version migration, last applied migration and if database schema is up to date or not
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Migrations status",
-	Long: `Shows migrations list with names, versions and applied at times, if the migration was applied.
+	Long: `Shows migrations list with names, versions, applied at times and batch numbers, if the migration was applied.
 It also shows the latest version migration, the last applied migrations (they are not necessarily the same ones),
-number of applied migrations and if the database schema is up to date or not.`,
+number of applied migrations and if the database schema is up to date or not.
+Applied migrations which files do not exist anymore are shown as missing.
+The partially executed migration is shown if the database is dirty.
+Use --output json or --output yaml to get the machine readable output.
+--check flag makes the command exit with distinct non-zero codes if the database is not up to date, so CI pipelines can branch on them:
+2 if there are pending migrations, 3 if there are applied migrations without files (unknown versions), 4 if the database can't be queried,
+5 if the database is dirty, i.e. the migration without transaction has been partially executed and should be repaired.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return status(migrator)
+		return status(ctx, migrator, statusFlags.output, statusFlags.check)
 	},
 }
 
+// statusReport is the representation of the migrations status used for json and yaml output
+type statusReport struct {
+	UpToDate      bool   `json:"up_to_date" yaml:"up_to_date"`
+	LatestVersion string `json:"latest_version,omitempty" yaml:"latest_version,omitempty"`
+	LastApplied   string `json:"last_applied,omitempty" yaml:"last_applied,omitempty"`
+	Applied       int    `json:"applied" yaml:"applied"`
+	Pending       int    `json:"pending" yaml:"pending"`
+	Missing       int    `json:"missing" yaml:"missing"`
+	// Dirty is set if the migration without transaction has been partially executed
+	Dirty      *dirtyStatus       `json:"dirty,omitempty" yaml:"dirty,omitempty"`
+	Migrations []*migrationStatus `json:"migrations" yaml:"migrations"`
+}
+
+// dirtyStatus is the state of the partially executed migration
+type dirtyStatus struct {
+	Version            string `json:"version" yaml:"version"`
+	Direction          string `json:"direction" yaml:"direction"`
+	ExecutedStatements int    `json:"executed_statements" yaml:"executed_statements"`
+}
+
+// migrationStatus is the status of the single migration, which is applied, pending or missing, i.e. applied, but its file doesn't exist
+type migrationStatus struct {
+	Version string `json:"version" yaml:"version"`
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Engine is set for engine specific migrations
+	Engine    string     `json:"engine,omitempty" yaml:"engine,omitempty"`
+	File      string     `json:"file,omitempty" yaml:"file,omitempty"`
+	Status    string     `json:"status" yaml:"status"`
+	AppliedAt *time.Time `json:"applied_at,omitempty" yaml:"applied_at,omitempty"`
+	Batch     int        `json:"batch,omitempty" yaml:"batch,omitempty"`
+	// Baselined is set for migrations recorded as applied by the baseline command without execution
+	Baselined bool `json:"baselined,omitempty" yaml:"baselined,omitempty"`
+}
+
+// statusCheckError is returned by status with --check flag if the database is not up to date, code is the exit code
+type statusCheckError struct {
+	code int
+	msg  string
+}
+
+func (e *statusCheckError) Error() string {
+	return e.msg
+}
+
 // status is the actual status function
-func status(migrator *dbmigrate.Migrator) error {
-	migrations, err := migrator.Status()
+func status(ctx context.Context, migrator *dbmigrate.Migrator, output string, check bool) error {
+	if output != "table" && output != "json" && output != "yaml" {
+		return errors.Errorf("unknown output format %s, should be table, json or yaml", output)
+	}
+
+	report, err := buildStatusReport(ctx, migrator)
 	if err != nil {
-		return errors.Wrap(err, "can't get migrations status")
+		err = errors.Wrap(err, "can't get migrations status")
+		if check {
+			return &statusCheckError{code: exitCodeConnection, msg: err.Error()}
+		}
+		return err
 	}
 
-	// function to format appliedAt timestamp
-	appliedAtRowFn := func(appliedAt time.Time) string {
-		if appliedAt == (time.Time{}) {
-			return "-"
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "can't encode status to JSON")
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		data, err := yaml.Marshal(report)
+		if err != nil {
+			return errors.Wrap(err, "can't encode status to YAML")
 		}
-		return appliedAt.Format(dbmigrate.PrintTimestampFormat)
+		fmt.Print(string(data))
+	default:
+		printStatusTable(report)
 	}
 
-	if len(migrations) == 0 {
-		fmt.Println("No migrations exist yet")
-		return nil
+	if check {
+		switch {
+		case report.Dirty != nil:
+			return &statusCheckError{code: exitCodeDirty, msg: fmt.Sprintf("database is dirty, migration with version %s has been partially executed",
+				report.Dirty.Version)}
+		case report.Missing > 0:
+			return &statusCheckError{code: exitCodeUnknownVersions, msg: fmt.Sprintf("%d applied %s without files", report.Missing, pluralize("migration", report.Missing))}
+		case report.Pending > 0:
+			return &statusCheckError{code: exitCodePending, msg: fmt.Sprintf("%d pending %s", report.Pending, pluralize("migration", report.Pending))}
+		}
 	}
+	return nil
+}
 
-	isUpToDate := true
+// buildStatusReport returns statuses of migrations files and of applied migrations without files, ordered by version
+func buildStatusReport(ctx context.Context, migrator *dbmigrate.Migrator) (*statusReport, error) {
+	migrations, err := migrator.StatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	verification, err := migrator.VerifyContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	// show igrations table
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Name", "Version", "Applied at"})
-	table.SetAutoWrapText(false)
+	dirty, err := migrator.DirtyContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &statusReport{UpToDate: dirty == nil, Migrations: []*migrationStatus{}}
+	if dirty != nil {
+		report.Dirty = &dirtyStatus{
+			Version: dirty.Version.Format(dbmigrate.TimestampFormat), Direction: dirty.Direction.String(), ExecutedStatements: dirty.ExecutedStatements,
+		}
+	}
+	var lastApplied *dbmigrate.Migration
 	for _, migration := range migrations {
-		table.Append([]string{
-			migration.HumanName(), migration.Version.Format(dbmigrate.TimestampFormat),
-			appliedAtRowFn(migration.AppliedAt),
-		})
+		ms := &migrationStatus{
+			Version: migration.Version.Format(dbmigrate.TimestampFormat), Name: migration.Name, Engine: migration.Engine,
+			File: migration.FileName(), Status: "pending",
+		}
+		if migration.AppliedAt.IsZero() {
+			report.Pending++
+			report.UpToDate = false
+		} else {
+			appliedAt := migration.AppliedAt
+			ms.Status, ms.AppliedAt, ms.Batch, ms.Baselined = "applied", &appliedAt, migration.Batch, migration.Baselined
+			report.Applied++
+		}
+		report.Migrations = append(report.Migrations, ms)
+		report.LatestVersion = ms.File
 
-		if migration.AppliedAt == (time.Time{}) {
-			isUpToDate = false
+		if !migration.AppliedAt.IsZero() && (lastApplied == nil || !migration.AppliedAt.Before(lastApplied.AppliedAt)) {
+			lastApplied = migration
 		}
 	}
-	table.Render()
+	if lastApplied != nil {
+		report.LastApplied = lastApplied.FileName()
+	}
 
-	lvm, err := migrator.LatestVersionMigration()
-	if err != nil {
-		return errors.Wrap(err, "can't get latest version migration")
+	for _, migration := range verification.Missing {
+		appliedAt := migration.AppliedAt
+		report.Migrations = append(report.Migrations, &migrationStatus{
+			Version: migration.Version.Format(dbmigrate.TimestampFormat), Status: "missing", AppliedAt: &appliedAt,
+		})
+		report.Applied++
+		report.Missing++
 	}
-	if lvm != nil {
-		fmt.Printf("Latest version migration is %s\n", lvm.FileName())
+	sort.SliceStable(report.Migrations, func(i, j int) bool {
+		return report.Migrations[i].Version < report.Migrations[j].Version
+	})
+
+	return report, nil
+}
+
+// printStatusTable prints the report as the table followed by the summary
+func printStatusTable(report *statusReport) {
+	if len(report.Migrations) == 0 {
+		fmt.Println("No migrations exist yet")
+		return
 	}
 
-	lam, err := migrator.LastAppliedMigration()
-	if err != nil {
-		return errors.Wrap(err, "can't get last applied migration")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Version", "Applied at", "Batch"})
+	table.SetAutoWrapText(false)
+	for _, ms := range report.Migrations {
+		name, appliedAt, batch := ms.Name, "-", "-"
+		if ms.Status == "missing" {
+			name = "(file is missing)"
+		}
+		if ms.AppliedAt != nil {
+			appliedAt = ms.AppliedAt.Format(dbmigrate.PrintTimestampFormat)
+		}
+		if ms.Batch != 0 {
+			batch = strconv.Itoa(ms.Batch)
+		}
+		if ms.Baselined {
+			batch += " (baseline)"
+		}
+		table.Append([]string{strings.Replace(name, "_", " ", -1), ms.Version, appliedAt, batch})
 	}
-	if lam != nil {
-		fmt.Printf("Last applied migration is %s\n", lam.FileName())
-	} else {
+	table.Render()
+
+	if report.LatestVersion != "" {
+		fmt.Printf("Latest version migration is %s\n", report.LatestVersion)
+	}
+	if report.LastApplied != "" {
+		fmt.Printf("Last applied migration is %s\n", report.LastApplied)
+	} else if report.Applied == 0 {
 		fmt.Println("No migrations were applied yet")
 	}
+	if report.Missing > 0 {
+		fmt.Printf("%d applied %s without files\n", report.Missing, pluralize("migration", report.Missing))
+	}
 
-	if isUpToDate {
+	if report.Dirty != nil {
+		fmt.Printf("Database is dirty, %s migration with version %s failed after %d %s had been executed, use repair command to fix it\n",
+			report.Dirty.Direction, report.Dirty.Version, report.Dirty.ExecutedStatements, pluralize("statement", report.Dirty.ExecutedStatements))
+	}
+
+	if report.UpToDate {
 		fmt.Println("Database schema is up to date")
 	} else {
 		fmt.Println("Database schema is not up to date")
 	}
-
-	return nil
 }
@@ -2,13 +2,18 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/dafanasev/dbmigrate"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 )
 
 func Test_status(t *testing.T) {
@@ -18,15 +23,16 @@ func Test_status(t *testing.T) {
 
 	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
 		Engine: "sqlite", Database: "test.db",
-		MigrationsCh: make(chan *dbmigrate.Migration), ErrorsCh: make(chan error),
+		Observer: &printObserver{},
 	})
 	defer migrator.Close()
 
-	statusWrapper := func() string {
+	var err error
+	statusWrapper := func(output string, check bool) string {
 		old := os.Stdout
 		r, w, _ := os.Pipe()
 		os.Stdout = w
-		status(migrator)
+		err = status(context.Background(), migrator, output, check)
 
 		resultCh := make(chan string)
 		go func() {
@@ -40,12 +46,12 @@ func Test_status(t *testing.T) {
 		return <-resultCh
 	}
 
-	output := statusWrapper()
+	output := statusWrapper("table", false)
 	assert.Contains(t, output, "No migrations exist yet")
 
 	createTestMigrations()
 
-	output = statusWrapper()
+	output = statusWrapper("table", false)
 	assert.Contains(t, output, "NAME")
 	assert.Contains(t, output, "No migrations were applied yet")
 	assert.Contains(t, output, "Database schema is not up to date")
@@ -55,8 +61,8 @@ func Test_status(t *testing.T) {
 		assert.Contains(t, output, migrationName)
 	}
 
-	migrate(migrator, 2)
-	output = statusWrapper()
+	migrate(context.Background(), migrator, 2, "")
+	output = statusWrapper("table", false)
 	assert.Contains(t, output, "NAME")
 	assert.Contains(t, output, "Latest version migration")
 	assert.Contains(t, output, "Last applied migration ")
@@ -64,12 +70,76 @@ func Test_status(t *testing.T) {
 	assert.Contains(t, output, "Database schema is not up to date", " - ")
 	assert.Contains(t, output, time.Now().UTC().Format("2006.01.02"))
 
-	migrate(migrator, dbmigrate.AllSteps)
-	output = statusWrapper()
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	output = statusWrapper("table", false)
 	assert.Contains(t, output, "NAME")
 	assert.Contains(t, output, "Latest version migration")
 	assert.Contains(t, output, "Last applied migration ")
 	assert.Contains(t, output, "Database schema is up to date")
 	assert.NotContains(t, output, "Database schema is not up to date", " - ")
 	assert.Contains(t, output, time.Now().UTC().Format("2006.01.02"))
+
+	statusWrapper("table", true)
+	assert.NoError(t, err)
+
+	statusWrapper("xml", false)
+	assert.EqualError(t, err, "unknown output format xml, should be table, json or yaml")
+}
+
+func Test_status_output(t *testing.T) {
+	os.Mkdir(dbmigrate.MigrationsDir, os.ModePerm)
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+	createTestMigrations()
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{Engine: "sqlite", Database: "test.db"})
+	defer migrator.Close()
+	migrate(context.Background(), migrator, 1, "")
+
+	report, err := buildStatusReport(context.Background(), migrator)
+	require.NoError(t, err)
+	assert.False(t, report.UpToDate)
+	assert.Equal(t, 1, report.Applied)
+	assert.Equal(t, 2, report.Pending)
+	require.Len(t, report.Migrations, 3)
+	assert.Equal(t, "applied", report.Migrations[0].Status)
+	assert.Equal(t, 1, report.Migrations[0].Batch)
+	assert.Equal(t, "pending", report.Migrations[1].Status)
+	assert.Nil(t, report.Migrations[1].AppliedAt)
+	assert.Equal(t, report.Migrations[0].File, report.LastApplied)
+	assert.Equal(t, report.Migrations[2].File, report.LatestVersion)
+
+	err = status(context.Background(), migrator, "json", true)
+	assert.Equal(t, &statusCheckError{code: exitCodePending, msg: "2 pending migrations"}, err)
+
+	// applied migration which file was removed
+	fname := report.Migrations[0].File
+	os.Rename(filepath.Join(dbmigrate.MigrationsDir, fname), fname)
+	defer os.Remove(fname)
+
+	report, err = buildStatusReport(context.Background(), migrator)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Missing)
+	assert.Equal(t, "missing", report.Migrations[0].Status)
+	assert.Empty(t, report.Migrations[0].Name)
+
+	data, err := yaml.Marshal(report)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "status: missing")
+
+	err = status(context.Background(), migrator, "yaml", true)
+	assert.Equal(t, &statusCheckError{code: exitCodeUnknownVersions, msg: "1 applied migration without files"}, err)
+
+	// dirty state is checked before pending and missing migrations
+	ioutil.WriteFile(filepath.Join(dbmigrate.MigrationsDir, "20180918202020.no_transaction.up.sql"),
+		[]byte("-- dbmigrate:no-transaction\nCREATE TABLE logs (message TEXT);\nERROR;"), os.ModePerm)
+	migrator.MigrateTo(time.Date(2018, 9, 18, 20, 20, 20, 0, time.UTC))
+	report, err = buildStatusReport(context.Background(), migrator)
+	require.NoError(t, err)
+	require.NotNil(t, report.Dirty)
+	assert.Equal(t, &dirtyStatus{Version: "20180918202020", Direction: "up", ExecutedStatements: 1}, report.Dirty)
+	assert.False(t, report.UpToDate)
+
+	err = status(context.Background(), migrator, "table", true)
+	assert.Equal(t, &statusCheckError{code: exitCodeDirty, msg: "database is dirty, migration with version 20180918202020 has been partially executed"}, err)
 }
@@ -1,21 +1,103 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dafanasev/dbmigrate"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 )
 
-// exitWithError prints an error to the terminal and terminates app with error
+// exitWithError prints an error to the terminal and terminates app with error,
+// the exit code is 1 unless the error is returned by status command with --check flag
 func exitWithError(err error) {
 	if migrator != nil {
 		migrator.Close()
 		migrator = nil
 	}
 
+	code := 1
+	if checkErr, ok := errors.Cause(err).(*statusCheckError); ok {
+		code = checkErr.code
+	}
+
 	fmt.Fprintln(os.Stderr, errors.Wrap(err, "can't run dbmigrate"))
-	os.Exit(1)
+	os.Exit(code)
+}
+
+// printObserver prints applied and rolled back migrations and non fatal errors
+type printObserver struct{}
+
+// Observe prints the event if it is interesting for the user
+func (o *printObserver) Observe(event *dbmigrate.Event) {
+	switch event.Type {
+	case dbmigrate.EventMigrationFinished:
+		if event.Migration.Direction == dbmigrate.DirectionUp {
+			fmt.Printf("migration %s has been successfully applied\n", event.Migration.FileName())
+		} else {
+			fmt.Printf("migration %s has been successfully rolled back\n", event.Migration.FileName())
+		}
+	case dbmigrate.EventMigrationSkipped:
+		fmt.Fprintf(os.Stderr, "migration %s has been skipped: %s\n", event.Migration.FileName(), event.Err)
+	case dbmigrate.EventWarning:
+		fmt.Fprintln(os.Stderr, errors.Wrap(event.Err, "warning"))
+	}
+}
+
+// statementLogger prints statements executed by migrations, with their durations and affected rows, as text or JSON lines
+type statementLogger struct {
+	json bool
+	out  io.Writer
+}
+
+// newStatementLogger returns statementLogger printing statements to out in the given format, text or json
+func newStatementLogger(format string, out io.Writer) (*statementLogger, error) {
+	if format != "text" && format != "json" {
+		return nil, errors.Errorf("unknown log format %s, should be text or json", format)
+	}
+	return &statementLogger{json: format == "json", out: out}, nil
+}
+
+// statementLogEntry is the JSON representation of the executed statement
+type statementLogEntry struct {
+	Migration    string  `json:"migration"`
+	Line         int     `json:"line"`
+	Statement    string  `json:"statement"`
+	DurationMs   float64 `json:"duration_ms"`
+	RowsAffected *int64  `json:"rows_affected,omitempty"`
+}
+
+// LogStatement prints the statement, the number of affected rows is not printed if rowsAffected is -1
+func (l *statementLogger) LogStatement(migration *dbmigrate.Migration, statement *dbmigrate.Statement, duration time.Duration, rowsAffected int64) {
+	if l.json {
+		entry := &statementLogEntry{
+			Migration: migration.FileName(), Line: statement.Line, Statement: statement.Query,
+			DurationMs: float64(duration) / float64(time.Millisecond),
+		}
+		if rowsAffected >= 0 {
+			entry.RowsAffected = &rowsAffected
+		}
+		data, _ := json.Marshal(entry)
+		fmt.Fprintln(l.out, string(data))
+		return
+	}
+
+	rows := ""
+	if rowsAffected >= 0 {
+		rows = fmt.Sprintf(", %d %s affected", rowsAffected, pluralize("row", int(rowsAffected)))
+	}
+	// statements are printed in one line, so the output can be grepped
+	fmt.Fprintf(l.out, "%s:%d executed in %s%s: %s\n",
+		migration.FileName(), statement.Line, duration, rows, strings.Join(strings.Fields(statement.Query), " "))
 }
 
 // pluralize currently just adds 's' to the given word if n != 1
@@ -25,3 +107,75 @@ func pluralize(s string, n int) string {
 	}
 	return s
 }
+
+// targetVersion returns the version of the migration specified by the --to flag,
+// which can be either the version or the name of the migration
+func targetVersion(migrator *dbmigrate.Migrator, steps int, to string) (time.Time, error) {
+	if steps != 0 {
+		return time.Time{}, errors.New("--steps and --to flags can't be used together")
+	}
+	return migrator.ResolveVersion(to)
+}
+
+// checkBatchFlag returns error if the --batch flag is used together with --steps or --to flags
+func checkBatchFlag(steps int, to string) error {
+	if steps != 0 || to != "" {
+		return errors.New("--batch flag can't be used together with --steps or --to flags")
+	}
+	return nil
+}
+
+// driverParams returns driver parameters, which are either the map in the config file
+// or the comma separated key=value pairs string given by the --params flag or the env var
+func driverParams(v *viper.Viper) (map[string]string, error) {
+	s, ok := v.Get("params").(string)
+	if !ok {
+		return v.GetStringMapString("params"), nil
+	}
+
+	params := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, errors.Errorf("wrong driver parameter %s, should be key=value", kv)
+		}
+		params[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return params, nil
+}
+
+// migrationsSource returns the migrations source for the path specified by the --source flag,
+// which is either a directory or an archive. Empty path gives nil source, so the default one is used
+func migrationsSource(path string) (dbmigrate.MigrationSource, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if dbmigrate.DirExists(path) {
+		return dbmigrate.DirSource(path), nil
+	}
+	if !dbmigrate.FileExists(path) {
+		return nil, errors.Errorf("migrations source %s does not exist", path)
+	}
+	return dbmigrate.ArchiveSource(path)
+}
+
+// interruptibleContext returns the context which is cancelled when the app receives SIGINT or SIGTERM,
+// so the running migration can be interrupted and its transaction rolled back.
+// The second signal terminates the app immediately
+func interruptibleContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		fmt.Fprintf(os.Stderr, "got %s signal, interrupting...\n", sig)
+		signal.Stop(sigCh)
+		cancel()
+	}()
+
+	return ctx
+}
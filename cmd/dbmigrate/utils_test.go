@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/dafanasev/dbmigrate"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_pluralize(t *testing.T) {
@@ -11,3 +17,74 @@ func Test_pluralize(t *testing.T) {
 	assert.Equal(t, "migrations", pluralize("migration", 2))
 	assert.Equal(t, "migrations", pluralize("migration", 0))
 }
+
+func Test_migrationsSource(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+
+	s, err := migrationsSource("")
+	require.NoError(t, err)
+	assert.Nil(t, s)
+
+	s, err = migrationsSource(dbmigrate.MigrationsDir)
+	require.NoError(t, err)
+	assert.Equal(t, dbmigrate.DirSource(dbmigrate.MigrationsDir), s)
+
+	_, err = migrationsSource("not_exists.zip")
+	assert.EqualError(t, err, "migrations source not_exists.zip does not exist")
+
+	f, _ := os.Create("migrations.rar")
+	f.Close()
+	defer os.Remove("migrations.rar")
+	_, err = migrationsSource("migrations.rar")
+	assert.Contains(t, err.Error(), "unsupported archive format")
+}
+
+func Test_driverParams(t *testing.T) {
+	v := viper.New()
+	params, err := driverParams(v)
+	require.NoError(t, err)
+	assert.Empty(t, params)
+
+	v.Set("params", "connect_timeout=10, application_name=dbmigrate,options=-c statement_timeout=0")
+	params, err = driverParams(v)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"connect_timeout": "10", "application_name": "dbmigrate", "options": "-c statement_timeout=0"}, params)
+
+	v.Set("params", map[string]interface{}{"charset": "utf8mb4", "timeout": 5})
+	params, err = driverParams(v)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"charset": "utf8mb4", "timeout": "5"}, params)
+
+	v.Set("params", "charset")
+	_, err = driverParams(v)
+	assert.EqualError(t, err, "wrong driver parameter charset, should be key=value")
+}
+
+func Test_statementLogger(t *testing.T) {
+	_, err := newStatementLogger("xml", nil)
+	assert.EqualError(t, err, "unknown log format xml, should be text or json")
+
+	migration := &dbmigrate.Migration{Version: time.Date(2018, 9, 18, 20, 4, 53, 0, time.UTC), Name: "create_posts", Direction: dbmigrate.DirectionUp}
+	statement := &dbmigrate.Statement{Query: "UPDATE posts\n  SET title = 'x'", Line: 3}
+
+	out := &bytes.Buffer{}
+	l, err := newStatementLogger("text", out)
+	require.NoError(t, err)
+	l.LogStatement(migration, statement, 15*time.Millisecond, 2)
+	l.LogStatement(migration, statement, time.Millisecond, -1)
+	assert.Equal(t, "20180918200453.create_posts.up.sql:3 executed in 15ms, 2 rows affected: UPDATE posts SET title = 'x'\n"+
+		"20180918200453.create_posts.up.sql:3 executed in 1ms: UPDATE posts SET title = 'x'\n", out.String())
+
+	out.Reset()
+	l, err = newStatementLogger("json", out)
+	require.NoError(t, err)
+	l.LogStatement(migration, statement, 1500*time.Microsecond, 1)
+	assert.JSONEq(t, `{"migration": "20180918200453.create_posts.up.sql", "line": 3, "statement": "UPDATE posts\n  SET title = 'x'",
+		"duration_ms": 1.5, "rows_affected": 1}`, out.String())
+
+	out.Reset()
+	l.LogStatement(migration, statement, 1500*time.Microsecond, -1)
+	assert.JSONEq(t, `{"migration": "20180918200453.create_posts.up.sql", "line": 3, "statement": "UPDATE posts\n  SET title = 'x'",
+		"duration_ms": 1.5}`, out.String())
+}
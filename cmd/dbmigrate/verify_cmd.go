@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd is the Cobra command that checks if applied migrations match the migrations files
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify applied migrations",
+	Long: `Compares applied migrations with the migrations files and exits with an error
+if files of applied migrations were changed or removed, or if there are not applied migrations older than applied ones.
+Migrations applied before checksums were recorded are not checked for changes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return verify(ctx, migrator)
+	},
+}
+
+// verify is the actual verify function
+func verify(ctx context.Context, migrator *dbmigrate.Migrator) error {
+	v, err := migrator.VerifyContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "can't verify migrations")
+	}
+
+	for _, migration := range v.Changed {
+		fmt.Printf("migration %s has been changed after it was applied\n", migration.FileName())
+	}
+	for _, migration := range v.Missing {
+		fmt.Printf("migration with version %s has been applied, but its file does not exist\n", migration.Version.Format(dbmigrate.TimestampFormat))
+	}
+	for _, migration := range v.Unknown {
+		fmt.Printf("migration %s has not been applied, although newer migrations have been\n", migration.FileName())
+	}
+
+	if v.HasDrift() {
+		return errors.New("applied migrations do not match migrations files")
+	}
+	fmt.Println("applied migrations match migrations files")
+
+	return nil
+}
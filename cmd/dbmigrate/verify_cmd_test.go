@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dafanasev/dbmigrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_verify(t *testing.T) {
+	createTestMigrations()
+	defer os.RemoveAll(dbmigrate.MigrationsDir)
+	defer os.Remove("test.db")
+
+	migrator, _ := dbmigrate.NewMigrator(&dbmigrate.Settings{
+		Engine: "sqlite", Database: "test.db",
+		Observer: &printObserver{},
+	})
+	defer migrator.Close()
+
+	err := verify(context.Background(), migrator)
+	require.NoError(t, err)
+
+	migrate(context.Background(), migrator, dbmigrate.AllSteps, "")
+	err = verify(context.Background(), migrator)
+	require.NoError(t, err)
+
+	ioutil.WriteFile(filepath.Join(dbmigrate.MigrationsDir, "20180918200453.first.up.sql"), []byte("CREATE TABLE changed (title VARCHAR NOT NULL);"), os.ModePerm)
+	err = verify(context.Background(), migrator)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "applied migrations do not match migrations files")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/dafanasev/dbmigrate"
 	"github.com/pkg/errors"
@@ -15,6 +16,7 @@ type viperConfigurator struct {
 	// initial viper, that can be substituted for
 	viper      *viper.Viper
 	flags      *appFlags
+	source     string // migrations source specified by the --source flag
 	projectDir string
 }
 
@@ -27,7 +29,12 @@ func (vc *viperConfigurator) configure() (*viper.Viper, error) {
 
 	vc.projectDir, err = dbmigrate.FindProjectDir(wd)
 	if err != nil {
-		return nil, err
+		// there is no project dir if migrations are read from the source specified by the --source flag,
+		// e.g. in containers that have no source tree, so the working dir is used to look for config then
+		if vc.source == "" {
+			return nil, err
+		}
+		vc.projectDir = wd
 	}
 
 	err = vc.readConfigFile()
@@ -112,12 +119,14 @@ func (vc *viperConfigurator) readEnv() {
 	}
 
 	vc.viper.SetEnvPrefix(envVarsPrefix)
+	// so the lock-timeout key is read from the {APP}_LOCK_TIMEOUT env var
+	vc.viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	vc.viper.AutomaticEnv()
 }
 
 // readFlags binds cobra flags to viper
 func (vc *viperConfigurator) readFlags() error {
-	for _, flag := range []string{"engine", "database", "user", "password", "host", "port", "table", "missingdowns"} {
+	for _, flag := range []string{"engine", "database", "user", "password", "host", "port", "url", "params", "ssl-mode", "ssl-ca", "ssl-cert", "ssl-key", "table", "schema", "missingdowns", "lock-timeout", "statement-timeout", "source"} {
 		err := vc.viper.BindPFlag(flag, migrateCmd.PersistentFlags().Lookup(flag))
 		if err != nil {
 			return errors.Wrapf(err, "can't bind flag %s", flag)
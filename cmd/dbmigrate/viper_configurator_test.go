@@ -138,3 +138,22 @@ func Test_viperConfigurator_configure(t *testing.T) {
 	_, err := vc.configure()
 	require.NoError(t, err)
 }
+
+func Test_viperConfigurator_configure_noProjectDir(t *testing.T) {
+	wd, _ := os.Getwd()
+	dir, err := ioutil.TempDir("", "dbmigrate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	vc := &viperConfigurator{viper: viper.New(), flags: &appFlags{}}
+	_, err = vc.configure()
+	assert.EqualError(t, err, "dbmigrations dir not found")
+
+	// working dir is used to look for config if migrations source is specified
+	vc = &viperConfigurator{viper: viper.New(), flags: &appFlags{}, source: "migrations.zip"}
+	_, err = vc.configure()
+	require.NoError(t, err)
+	assert.Equal(t, dir, vc.projectDir)
+}
@@ -1,6 +1,7 @@
 package dbmigrate
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -18,28 +19,44 @@ var (
 type dbWrapper struct {
 	*Settings
 	db *sql.DB
-	provider
-	placeholdersProvider
+	// ownsDB specifies if db was opened by dbWrapper, so it should be closed by it
+	ownsDB bool
+	// lockConn is the connection holding the migrations lock, nil if the lock is not acquired
+	lockConn *sql.Conn
+	provider Provider
+	// placeholdersProvider is the provider if it implements PlaceholdersProvider interface, nil otherwise
+	placeholdersProvider PlaceholdersProvider
 }
 
 // executor is an interface to exec sql so we could pass db instance as well as tx one
 type executor interface {
-	Exec(query string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 }
 
 // migrationData holds info about migration from migrations table
 type migrationData struct {
 	version   time.Time
 	appliedAt time.Time
+	// checksum is empty for migrations applied before checksums were recorded
+	checksum string
+	// batch is the number of migrate operation the migration was applied during
+	batch int
+	// duration, appliedBy, host and dbmigrateVersion are empty for migrations applied by older dbmigrate versions
+	duration         time.Duration
+	appliedBy        string
+	host             string
+	dbmigrateVersion string
+	// baselined specifies if the migration was recorded by Baseline without execution
+	baselined bool
 }
 
 // newDBWrapper creates new dbWrapper instance
-func newDBWrapper(settings *Settings, provider provider) *dbWrapper {
+func newDBWrapper(settings *Settings, provider Provider) *dbWrapper {
 	w := &dbWrapper{
 		Settings: settings,
 		provider: provider,
 	}
-	if pp, ok := w.provider.(placeholdersProvider); ok {
+	if pp, ok := w.provider.(PlaceholdersProvider); ok {
 		w.placeholdersProvider = pp
 	}
 
@@ -48,21 +65,30 @@ func newDBWrapper(settings *Settings, provider provider) *dbWrapper {
 
 // open creates new database connection
 func (w *dbWrapper) open() error {
-	dsn, err := w.provider.dsn(w.Settings)
+	dsn, err := w.provider.DSN(w.Settings)
 	if err != nil {
 		return err
 	}
 
-	w.db, err = sql.Open(w.provider.driver(), dsn)
+	w.db, err = sql.Open(w.provider.Driver(), dsn)
 	if err != nil {
 		return errors.Wrap(err, "can't open database")
 	}
+	w.ownsDB = true
 
 	return nil
 }
 
-// close shuts down database connection
+// close shuts down database connection, releasing the migrations lock if it is still held
 func (w *dbWrapper) close() error {
+	if w.lockConn != nil {
+		w.unlock()
+	}
+
+	// the db passed to NewMigratorWithDB is closed by its owner
+	if !w.ownsDB {
+		return nil
+	}
 	err := w.db.Close()
 	if err != nil {
 		return errors.Wrap(err, "can't close db")
@@ -70,18 +96,87 @@ func (w *dbWrapper) close() error {
 	return nil
 }
 
-// setPlaceholders calls placeholdersProvider's placeholdersProvider if it is provided
+// lock acquires the database-level migrations lock on a dedicated connection,
+// because session level locks must be released using the same connection they were acquired with
+func (w *dbWrapper) lock(ctx context.Context) error {
+	conn, err := w.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "can't get connection for the lock")
+	}
+
+	// negative timeout means not waiting, providers try to acquire the lock only once with zero timeout
+	timeout := w.LockTimeout
+	if timeout < 0 {
+		timeout = 0
+	}
+
+	err = w.provider.Lock(ctx, conn, w.migrationsTable(), timeout)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	w.lockConn = conn
+	return nil
+}
+
+// unlock releases the migrations lock and the connection holding it
+func (w *dbWrapper) unlock() error {
+	err := w.provider.Unlock(w.lockConn, w.migrationsTable())
+	w.lockConn.Close()
+	w.lockConn = nil
+	if err != nil {
+		return errors.Wrap(err, "can't release lock")
+	}
+	return nil
+}
+
+// transactionalDDL checks if DDL statements are rolled back with the transaction,
+// engines of providers which don't implement TransactionalDDLProvider are assumed to commit them implicitly
+func (w *dbWrapper) transactionalDDL() bool {
+	tp, ok := w.provider.(TransactionalDDLProvider)
+	return ok && tp.TransactionalDDL()
+}
+
+// setPlaceholders calls placeholdersProvider's SetPlaceholders if it is provided
 func (w *dbWrapper) setPlaceholders(s string) string {
 	if w.placeholdersProvider == nil {
 		return s
 	}
-	return w.placeholdersProvider.setPlaceholders(s)
+	return w.placeholdersProvider.SetPlaceholders(s)
+}
+
+// migrationsTable returns the name of the migrations table, qualified with the schema if it is set
+func (w *dbWrapper) migrationsTable() string {
+	return w.qualifiedTable(w.MigrationsTable)
+}
+
+// qualifiedTable returns the table name qualified with the schema if it is set
+func (w *dbWrapper) qualifiedTable(table string) string {
+	if w.Schema == "" {
+		return table
+	}
+	return w.Schema + "." + table
+}
+
+// createSchema creates the schema if it does not exist yet
+func (w *dbWrapper) createSchema(ctx context.Context) error {
+	_, err := w.db.ExecContext(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", w.Schema))
+	if err != nil {
+		return errors.Wrapf(err, "can't create schema %s", w.Schema)
+	}
+	return nil
 }
 
 // hasMigrationsTable checks if the table with applied migrations data already exists
-func (w *dbWrapper) hasMigrationsTable() (bool, error) {
+func (w *dbWrapper) hasMigrationsTable(ctx context.Context) (bool, error) {
+	return w.hasTable(ctx, w.MigrationsTable)
+}
+
+// hasTable checks if the table with the given unqualified name exists in the current schema
+func (w *dbWrapper) hasTable(ctx context.Context, name string) (bool, error) {
 	var table string
-	err := w.db.QueryRow(w.setPlaceholders(w.provider.hasTableQuery()), w.MigrationsTable).Scan(&table)
+	err := w.db.QueryRowContext(ctx, w.setPlaceholders(w.provider.HasTableQuery()), name).Scan(&table)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
@@ -91,19 +186,72 @@ func (w *dbWrapper) hasMigrationsTable() (bool, error) {
 	return true, nil
 }
 
-// createMigrationsTable creates new table for applied migrations data
-func (w *dbWrapper) createMigrationsTable() error {
-	_, err := w.db.Exec(fmt.Sprintf(
-		"CREATE TABLE %s (version VARCHAR(14) NOT NULL, applied_at VARCHAR(14) NOT NULL, PRIMARY KEY(version));", w.MigrationsTable))
+// createMigrationsTable creates new table for applied migrations data with the current schema, the history and the dirty state tables,
+// holding the migrations lock, so the tables are created only once if several processes connect to the empty database at the same time
+func (w *dbWrapper) createMigrationsTable(ctx context.Context) error {
+	err := w.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer w.unlock()
+
+	// the table could have been created by another process while waiting for the lock
+	exists, err := w.hasMigrationsTable(ctx)
+	if err != nil {
+		return errors.Wrap(err, "can't check if migrations table exists")
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = w.db.ExecContext(ctx, w.migrationsTableQuery(w.migrationsTable()))
 	if err != nil {
 		return errors.Wrap(err, "can't create migrations table")
 	}
+	err = w.createHistoryTable(ctx)
+	if err != nil {
+		return err
+	}
+	err = w.createDirtyTable(ctx)
+	if err != nil {
+		return err
+	}
+	return w.setMigrationsTableSchemaVersion(ctx, migrationsTableVersion)
+}
+
+// hasMigrationsTableColumn checks if the table with applied migrations data has the column,
+// getting columns of the empty result is the simplest way which works for all supported engines
+func (w *dbWrapper) hasMigrationsTableColumn(ctx context.Context, column string) (bool, error) {
+	rows, err := w.db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", w.migrationsTable()))
+	if err != nil {
+		return false, errors.Wrap(err, "can't get migrations table columns")
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, errors.Wrap(err, "can't get migrations table columns")
+	}
+	for _, c := range columns {
+		if strings.EqualFold(c, column) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// addMigrationsTableColumn adds the column to the table created by the older dbmigrate version
+func (w *dbWrapper) addMigrationsTableColumn(ctx context.Context, column string, definition string) error {
+	_, err := w.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD %s %s", w.migrationsTable(), column, definition))
+	if err != nil {
+		return errors.Wrapf(err, "can't add column %s to migrations table", column)
+	}
 	return nil
 }
 
 // latestMigrationVersion returns a timestamp for latest migration version
-func (w *dbWrapper) latestMigrationVersion() (time.Time, error) {
-	version, err := w.getAttrOrderedBy("version", "version DESC")
+func (w *dbWrapper) latestMigrationVersion(ctx context.Context) (time.Time, error) {
+	version, err := w.getAttrOrderedBy(ctx, "version", "version DESC")
 	if err != nil {
 		return time.Time{}, errors.Wrap(err, "can't select latest migration version from database")
 	}
@@ -111,8 +259,8 @@ func (w *dbWrapper) latestMigrationVersion() (time.Time, error) {
 }
 
 // lastAppliedMigrationVersion returns a latest applied migration version timestamp
-func (w *dbWrapper) lastAppliedMigrationVersion() (time.Time, error) {
-	version, err := w.getAttrOrderedBy("version", "applied_at DESC, version DESC")
+func (w *dbWrapper) lastAppliedMigrationVersion(ctx context.Context) (time.Time, error) {
+	version, err := w.getAttrOrderedBy(ctx, "version", "batch DESC, applied_at DESC, version DESC")
 	if err != nil {
 		return time.Time{}, errors.Wrap(err, "can't select last applied migration version from database")
 	}
@@ -120,9 +268,9 @@ func (w *dbWrapper) lastAppliedMigrationVersion() (time.Time, error) {
 }
 
 // getAttrOrderedBy returns first attr ordered by order
-func (w *dbWrapper) getAttrOrderedBy(attr string, order string) (time.Time, error) {
+func (w *dbWrapper) getAttrOrderedBy(ctx context.Context, attr string, order string) (time.Time, error) {
 	var result string
-	err := w.db.QueryRow(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s LIMIT 1", attr, w.MigrationsTable, order)).Scan(&result)
+	err := w.db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY %s LIMIT 1", attr, w.migrationsTable(), order)).Scan(&result)
 	if err == sql.ErrNoRows {
 		return time.Time{}, nil
 	}
@@ -134,37 +282,59 @@ func (w *dbWrapper) getAttrOrderedBy(attr string, order string) (time.Time, erro
 }
 
 // appliedMigrationsData returns all data from migrations table ordered by provided order variable
-func (w *dbWrapper) appliedMigrationsData(order string) ([]*migrationData, error) {
-	rows, err := w.db.Query(fmt.Sprintf("SELECT version, applied_at FROM %s ORDER BY %s", w.MigrationsTable, order))
+func (w *dbWrapper) appliedMigrationsData(ctx context.Context, order string) ([]*migrationData, error) {
+	rows, err := w.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT version, applied_at, duration_ms, batch, checksum, applied_by, host, dbmigrate_version, baselined FROM %s ORDER BY %s",
+		w.migrationsTable(), order))
 	if err != nil {
 		return nil, errors.Wrap(err, "can't get applied migrations versions")
 	}
 	defer rows.Close()
 
 	var mds []*migrationData
-	var version, appliedAt string
+	var version string
+	var appliedAt time.Time
+	var duration, batch, baselined sql.NullInt64
+	var checksum, appliedBy, host, dbmigrateVersion sql.NullString
 	for rows.Next() {
-		err = rows.Scan(&version, &appliedAt)
+		err = rows.Scan(&version, &appliedAt, &duration, &batch, &checksum, &appliedBy, &host, &dbmigrateVersion, &baselined)
 		if err != nil {
 			return nil, errors.Wrap(err, "can't scan migrations table's row")
 		}
 
-		md := &migrationData{}
+		md := &migrationData{
+			appliedAt: appliedAt.UTC(), duration: time.Duration(duration.Int64) * time.Millisecond, batch: int(batch.Int64),
+			checksum: checksum.String, appliedBy: appliedBy.String, host: host.String, dbmigrateVersion: dbmigrateVersion.String,
+			baselined: baselined.Int64 != 0,
+		}
 		md.version, _ = time.Parse(TimestampFormat, version)
-		md.appliedAt, _ = time.Parse(TimestampFormat, appliedAt)
 		mds = append(mds, md)
 	}
 	return mds, nil
 }
 
+// appliedMigrationData returns data of the applied migration with the given version, nil if it is not applied
+func (w *dbWrapper) appliedMigrationData(ctx context.Context, version time.Time) (*migrationData, error) {
+	mds, err := w.appliedMigrationsData(ctx, "version ASC")
+	if err != nil {
+		return nil, err
+	}
+	for _, md := range mds {
+		if md.version.Equal(version) {
+			return md, nil
+		}
+	}
+	return nil, nil
+}
+
 // insertMigrationData inserts data for applied migration
-func (w *dbWrapper) insertMigrationData(version time.Time, appliedAtTs time.Time, executor executor) error {
+func (w *dbWrapper) insertMigrationData(ctx context.Context, md *migrationData, executor executor) error {
 	if executor == nil {
 		executor = w.db
 	}
 
-	_, err := executor.Exec(w.setPlaceholders(fmt.Sprintf("INSERT INTO %s (version, applied_at) VALUES (?, ?)", w.MigrationsTable)),
-		version.UTC().Format(TimestampFormat), appliedAtTs.UTC().Format(TimestampFormat))
+	query, args := w.insertMigrationDataQuery(md)
+	_, err := executor.ExecContext(ctx, w.setPlaceholders(query), args...)
 	if err != nil {
 		return errors.Wrap(err, "can't insert migration")
 	}
@@ -172,29 +342,54 @@ func (w *dbWrapper) insertMigrationData(version time.Time, appliedAtTs time.Time
 	return nil
 }
 
-// countMigrationsInLastBatch returns number of migrations which were applied during the last database operation
-func (w *dbWrapper) countMigrationsInLastBatch() (int, error) {
-	var count int
-	err := w.db.QueryRow(w.setPlaceholders("SELECT COUNT(*) FROM migrations GROUP BY applied_at ORDER BY applied_at DESC LIMIT 1")).Scan(&count)
-	if err == sql.ErrNoRows {
-		return 0, nil
+// lastBatch returns the number of the last migrate operation, 0 if there were none
+func (w *dbWrapper) lastBatch(ctx context.Context) (int, error) {
+	var batch int
+	err := w.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(MAX(batch), 0) FROM %s", w.migrationsTable())).Scan(&batch)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't get last batch")
 	}
+	return batch, nil
+}
+
+// fillBatches sets batch numbers for migrations applied by older dbmigrate versions,
+// which grouped migrations to batches by applied at time
+func (w *dbWrapper) fillBatches(ctx context.Context) error {
+	rows, err := w.db.QueryContext(ctx, fmt.Sprintf("SELECT DISTINCT applied_at FROM %s ORDER BY applied_at ASC", w.migrationsTable()))
 	if err != nil {
-		return 0, errors.Wrapf(err, "can't count migrations for last batch")
+		return errors.Wrap(err, "can't get applied at times")
 	}
 
-	return count, nil
+	var appliedAts []string
+	for rows.Next() {
+		var appliedAt string
+		err = rows.Scan(&appliedAt)
+		if err != nil {
+			rows.Close()
+			return errors.Wrap(err, "can't scan applied at time")
+		}
+		appliedAts = append(appliedAts, appliedAt)
+	}
+	rows.Close()
+
+	for i, appliedAt := range appliedAts {
+		_, err = w.db.ExecContext(ctx, w.setPlaceholders(fmt.Sprintf("UPDATE %s SET batch = ? WHERE applied_at = ?", w.migrationsTable())),
+			i+1, appliedAt)
+		if err != nil {
+			return errors.Wrapf(err, "can't set batch for migrations applied at %s", appliedAt)
+		}
+	}
+	return nil
 }
 
 // deleteMigrationVersion removes database row with given migration version
-func (w *dbWrapper) deleteMigrationVersion(version time.Time, executor executor) error {
+func (w *dbWrapper) deleteMigrationVersion(ctx context.Context, version time.Time, executor executor) error {
 	if executor == nil {
 		executor = w.db
 	}
 
-	_, err := executor.Exec(w.setPlaceholders(fmt.Sprintf(
-		"DELETE FROM %s WHERE version = ?", w.MigrationsTable)),
-		version.UTC().Format(TimestampFormat))
+	query, args := w.deleteMigrationVersionQuery(version)
+	_, err := executor.ExecContext(ctx, w.setPlaceholders(query), args...)
 	if err != nil {
 		return errors.Wrap(err, "can't delete migration")
 	}
@@ -202,23 +397,66 @@ func (w *dbWrapper) deleteMigrationVersion(version time.Time, executor executor)
 	return nil
 }
 
-// execMigrationQueries executes queries from the migration file, calling func after
-func (w *dbWrapper) execMigrationQueries(query string, afterFunc func(tx *sql.Tx) error) error {
+// insertMigrationDataQuery returns the query, with ? placeholders, and its args used to insert data for applied migration
+func (w *dbWrapper) insertMigrationDataQuery(md *migrationData) (string, []interface{}) {
+	baselined := 0
+	if md.baselined {
+		baselined = 1
+	}
+	return fmt.Sprintf("INSERT INTO %s (version, applied_at, duration_ms, batch, checksum, applied_by, host, dbmigrate_version, baselined) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", w.migrationsTable()),
+		[]interface{}{
+			md.version.UTC().Format(TimestampFormat), md.appliedAt.UTC().Format(dbTimestampFormat), int64(md.duration / time.Millisecond),
+			md.batch, md.checksum, md.appliedBy, md.host, md.dbmigrateVersion, baselined,
+		}
+}
+
+// deleteMigrationVersionQuery returns the query, with ? placeholders, and its args used to remove row with given migration version
+func (w *dbWrapper) deleteMigrationVersionQuery(version time.Time) (string, []interface{}) {
+	return fmt.Sprintf("DELETE FROM %s WHERE version = ?", w.migrationsTable()), []interface{}{version.UTC().Format(TimestampFormat)}
+}
+
+// execMigrationQueries executes queries from the migration file, skipping the first executed ones, which is not 0
+// only if the partially executed migration is resumed, calling statementFunc, which can be nil,
+// after each statement and afterFunc after all of them. Execution is stopped if statementFunc returns an error.
+// If ctx is cancelled, the query being executed is interrupted and the transaction is rolled back.
+// If useTx is false, queries are executed without transaction and afterFunc is called only if all of them succeeded
+func (w *dbWrapper) execMigrationQueries(ctx context.Context, query string, executed int, useTx bool,
+	statementFunc func(st *Statement, duration time.Duration, rowsAffected int64) error, afterFunc func(executor executor) error) error {
+	// split queries and exec them one by one, because mysql driver can't exec multiple queries using one Exec call
+	statements, err := w.provider.SplitStatements(query)
+	if err != nil {
+		return errors.Wrap(err, "can't split migration into statements")
+	}
+	if executed > len(statements) {
+		return errors.Errorf("migration has %d statements, but %d of them have been executed, it was probably changed", len(statements), executed)
+	}
+	statements = statements[executed:]
+
+	if !useTx {
+		return w.execStatementsWithoutTx(ctx, statements, statementFunc, afterFunc)
+	}
+
 	// using transactions, although only postgres supports supports DDL ones
-	tx, err := w.db.Begin()
+	tx, err := w.db.BeginTx(ctx, nil)
 	if err != nil {
 		return errors.Wrap(err, "can't begin transaction")
 	}
 
-	// split queries and exec them one by one, because mysql driver can't exec multiple queries using one Exec call
-	queries := strings.Split(query, ";")
-	for _, q := range queries {
-		q := strings.TrimSpace(q)
-		if q != "" {
-			_, err := tx.Exec(q + ";")
+	for _, st := range statements {
+		start := time.Now()
+		stCtx, cancel := w.statementContext(ctx)
+		result, err := tx.ExecContext(stCtx, st.Query+";")
+		cancel()
+		if err != nil {
+			tx.Rollback()
+			return statementError(ctx, stCtx, err, st)
+		}
+		if statementFunc != nil {
+			err = statementFunc(st, time.Since(start), rowsAffected(st, result))
 			if err != nil {
 				tx.Rollback()
-				return errors.Wrapf(err, "can't execute query %s", q)
+				return err
 			}
 		}
 	}
@@ -236,3 +474,106 @@ func (w *dbWrapper) execMigrationQueries(query string, afterFunc func(tx *sql.Tx
 
 	return nil
 }
+
+// execMigrationFunc executes the function of Go migration inside transaction, calling afterFunc using the same transaction
+func (w *dbWrapper) execMigrationFunc(ctx context.Context, fn GoMigrationFunc, afterFunc func(executor executor) error) error {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can't begin transaction")
+	}
+
+	err = fn(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		if ctx.Err() != nil {
+			return errors.Wrap(ctx.Err(), "interrupted while executing Go function")
+		}
+		return err
+	}
+
+	err = afterFunc(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+
+	return nil
+}
+
+// execStatementsWithoutTx executes statements one by one using the same connection, so session settings are kept,
+// e.g. for queries such as postgres CREATE INDEX CONCURRENTLY, that can't be run inside transaction
+func (w *dbWrapper) execStatementsWithoutTx(ctx context.Context, statements []*Statement,
+	statementFunc func(st *Statement, duration time.Duration, rowsAffected int64) error, afterFunc func(executor executor) error) error {
+	conn, err := w.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "can't get connection")
+	}
+	defer conn.Close()
+
+	for i, st := range statements {
+		start := time.Now()
+		stCtx, cancel := w.statementContext(ctx)
+		result, err := conn.ExecContext(stCtx, st.Query+";")
+		cancel()
+		if err != nil {
+			err = statementError(ctx, stCtx, err, st)
+			if i > 0 {
+				return errors.Wrapf(err, "migration is not transactional, %d of %d statements have been executed and should be resumed or reverted manually",
+					i, len(statements))
+			}
+			return err
+		}
+		if statementFunc != nil {
+			err = statementFunc(st, time.Since(start), rowsAffected(st, result))
+			if err != nil {
+				return errors.Wrapf(err, "migration is not transactional, %d of %d statements have been executed, but the last one can't be tracked",
+					i+1, len(statements))
+			}
+		}
+	}
+
+	err = afterFunc(conn)
+	if err != nil {
+		return errors.Wrap(err, "migration is not transactional, all statements have been executed, but the migration is not recorded")
+	}
+
+	return nil
+}
+
+// rowsAffected returns the number of rows affected by the statement, or -1 if the statement doesn't change rows
+// or the driver doesn't support it, e.g. sqlite reports the count of the previous DML statement for DDL ones
+func rowsAffected(st *Statement, result sql.Result) int64 {
+	if !isDML(st.Query) {
+		return -1
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// statementContext returns the context the single statement is executed with, limited by StatementTimeout if it is set
+func (w *dbWrapper) statementContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if w.StatementTimeout > 0 {
+		return context.WithTimeout(ctx, w.StatementTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// statementError builds an error pointing to the failed statement, telling if it was interrupted or timed out,
+// stCtx is the context of the statement returned by statementContext
+func statementError(ctx context.Context, stCtx context.Context, err error, st *Statement) error {
+	if ctx.Err() != nil {
+		return errors.Wrapf(ctx.Err(), "interrupted while executing query at line %d %s", st.Line, st.Query)
+	}
+	if stCtx.Err() == context.DeadlineExceeded {
+		return errors.Wrapf(stCtx.Err(), "statement timeout exceeded while executing query at line %d %s", st.Line, st.Query)
+	}
+	return errors.Wrapf(err, "can't execute query at line %d %s", st.Line, st.Query)
+}
@@ -1,17 +1,19 @@
 package dbmigrate
 
 import (
-	"database/sql"
+	"context"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func Test_newDBWrapper(t *testing.T) {
 	s := &Settings{}
-	for _, p := range []provider{&postgresProvider{}, &mysqlProvider{}, &sqliteProvider{}} {
+	for _, p := range []Provider{&postgresProvider{}, &mysqlProvider{}, &sqliteProvider{}} {
 		w := newDBWrapper(s, p)
 		if _, ok := p.(*postgresProvider); ok {
 			assert.NotNil(t, w.placeholdersProvider)
@@ -24,7 +26,7 @@ func Test_newDBWrapper(t *testing.T) {
 func Test_dbWrapper_setPlaceholders(t *testing.T) {
 	s := &Settings{}
 	str := "SELECT * FROM posts WHERE author_id = ? AND created_AT > ? LIMIT 10 ORDER BY created_at ?"
-	for _, p := range []provider{&postgresProvider{}, &mysqlProvider{}, &sqliteProvider{}} {
+	for _, p := range []Provider{&postgresProvider{}, &mysqlProvider{}, &sqliteProvider{}} {
 		w := newDBWrapper(s, p)
 		if _, ok := p.(*postgresProvider); ok {
 			expected := "SELECT * FROM posts WHERE author_id = $1 AND created_AT > $2 LIMIT 10 ORDER BY created_at $3"
@@ -36,6 +38,7 @@ func Test_dbWrapper_setPlaceholders(t *testing.T) {
 }
 
 func Test_dbWrapper(t *testing.T) {
+	ctx := context.Background()
 	// test for all dbWrapper functions except execMigrationsQuery on all supported engines
 	for engine, provider := range providers {
 		s := &Settings{Engine: engine, Database: "migrate_test", User: "dbmigrate", Password: "mysecretpassword", MigrationsTable: "migrations"}
@@ -50,77 +53,88 @@ func Test_dbWrapper(t *testing.T) {
 		err := w.open()
 		require.NoError(t, err)
 
-		tableExist, err := w.hasMigrationsTable()
+		tableExist, err := w.hasMigrationsTable(ctx)
 		assert.NoError(t, err)
 		assert.False(t, tableExist)
+		_, err = w.hasMigrationsTableColumn(ctx, "checksum")
+		assert.Error(t, err)
 
-		err = w.createMigrationsTable()
+		err = w.createMigrationsTable(ctx)
 		assert.NoError(t, err)
 
-		err = w.createMigrationsTable()
-		assert.Error(t, err)
+		// the existing table is not created again
+		err = w.createMigrationsTable(ctx)
+		assert.NoError(t, err)
 
-		tableExist, err = w.hasMigrationsTable()
+		tableExist, err = w.hasMigrationsTable(ctx)
 		assert.NoError(t, err)
 		assert.True(t, tableExist)
 
-		ts, err := w.latestMigrationVersion()
+		hasColumn, err := w.hasMigrationsTableColumn(ctx, "checksum")
+		assert.NoError(t, err)
+		assert.True(t, hasColumn)
+		hasColumn, err = w.hasMigrationsTableColumn(ctx, "not_exist")
+		assert.NoError(t, err)
+		assert.False(t, hasColumn)
+
+		ts, err := w.latestMigrationVersion(ctx)
 		// no error and null time value means there are no migrations in the table
 		assert.NoError(t, err)
 		assert.Equal(t, time.Time{}, ts)
 
-		mds, err := w.appliedMigrationsData("version DESC")
+		mds, err := w.appliedMigrationsData(ctx, "version DESC")
 		assert.NoError(t, err)
 		assert.Equal(t, []*migrationData(nil), mds)
 
-		n, err := w.countMigrationsInLastBatch()
+		n, err := w.lastBatch(ctx)
 		assert.NoError(t, err)
 		assert.Zero(t, n)
 
 		baseTs := time.Date(2010, 6, 7, 8, 9, 10, 0, time.UTC)
 		now := time.Now().UTC().Truncate(time.Second)
 		for i := 0; i < 2; i++ {
-			err = w.insertMigrationData(baseTs.Add(time.Duration(i)*time.Second), now, nil)
+			err = w.insertMigrationData(ctx, &migrationData{version: baseTs.Add(time.Duration(i) * time.Second), appliedAt: now, checksum: "checksum", batch: 1}, nil)
 			assert.NoError(t, err)
 		}
 
-		ts, err = w.latestMigrationVersion()
+		ts, err = w.latestMigrationVersion(ctx)
 		assert.NoError(t, err)
 		assert.Equal(t, baseTs.Add(time.Second), ts)
 
-		_, err = w.getAttrOrderedBy("error_attr", "error_attr DESC")
+		_, err = w.getAttrOrderedBy(ctx, "error_attr", "error_attr DESC")
 		require.Error(t, err)
 
-		ts, err = w.getAttrOrderedBy("applied_at", "applied_at DESC")
+		ts, err = w.getAttrOrderedBy(ctx, "version", "version ASC")
 		assert.NoError(t, err)
-		assert.Equal(t, now, ts)
+		assert.Equal(t, baseTs, ts)
 
-		n, err = w.countMigrationsInLastBatch()
+		n, err = w.lastBatch(ctx)
 		assert.NoError(t, err)
-		assert.Equal(t, 2, n)
+		assert.Equal(t, 1, n)
 
-		_, err = w.appliedMigrationsData("version RASC")
+		_, err = w.appliedMigrationsData(ctx, "version RASC")
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "can't get applied migrations versions")
 
-		mds, err = w.appliedMigrationsData("version DESC")
+		mds, err = w.appliedMigrationsData(ctx, "version DESC")
 		assert.NoError(t, err)
 		assert.Equal(t, []time.Time{baseTs.Add(time.Second), baseTs}, []time.Time{mds[0].version, mds[1].version})
 		for _, md := range mds {
-			assert.NotEqual(t, time.Time{}, md.appliedAt)
+			assert.Equal(t, now, md.appliedAt)
+			assert.Equal(t, "checksum", md.checksum)
 		}
 
-		mds, err = w.appliedMigrationsData("version ASC")
+		mds, err = w.appliedMigrationsData(ctx, "version ASC")
 		assert.NoError(t, err)
 		assert.Equal(t, []time.Time{baseTs, baseTs.Add(time.Second)}, []time.Time{mds[0].version, mds[1].version})
 		for _, md := range mds {
 			assert.NotEqual(t, time.Time{}, md.appliedAt)
 		}
 
-		err = w.deleteMigrationVersion(baseTs.Add(time.Second), nil)
+		err = w.deleteMigrationVersion(ctx, baseTs.Add(time.Second), nil)
 		assert.NoError(t, err)
 
-		ts, err = w.latestMigrationVersion()
+		ts, err = w.latestMigrationVersion(ctx)
 		assert.NoError(t, err)
 		assert.Equal(t, baseTs, ts)
 
@@ -131,7 +145,19 @@ func Test_dbWrapper(t *testing.T) {
 	}
 }
 
+func Test_dbWrapper_qualifiedTable(t *testing.T) {
+	w := newDBWrapper(&Settings{MigrationsTable: "migrations"}, &postgresProvider{})
+	assert.Equal(t, "migrations", w.migrationsTable())
+	assert.Equal(t, "migrations_history", w.historyTable())
+
+	w.Schema = "meta"
+	assert.Equal(t, "meta.migrations", w.migrationsTable())
+	assert.Equal(t, "meta.migrations_history", w.historyTable())
+	assert.Equal(t, "meta.migrations_version", w.qualifiedTable(w.versionTable()))
+}
+
 func Test_dbWrapper_execMigrationQueries(t *testing.T) {
+	ctx := context.Background()
 	for engine, provider := range providers {
 		s := &Settings{Engine: engine, Database: "migrate_test", User: "dbmigrate", Password: "mysecretpassword", MigrationsTable: "migrations"}
 		if engine == "postgres" {
@@ -144,22 +170,22 @@ func Test_dbWrapper_execMigrationQueries(t *testing.T) {
 		w := newDBWrapper(s, provider)
 		w.open()
 
-		afterFunc := func(tx *sql.Tx) error {
+		afterFunc := func(executor executor) error {
 			return nil
 		}
 
 		// incorrect one command query
-		err := w.execMigrationQueries("CREATE TABLE posts ERROR title VARCHAR(255) NOT NULL, PRIMARY KEY(title));", afterFunc)
+		err := w.execMigrationQueries(ctx, "CREATE TABLE posts ERROR title VARCHAR(255) NOT NULL, PRIMARY KEY(title));", 0, true, nil, afterFunc)
 		assert.Error(t, err)
-		tableExists, _ := w.hasMigrationsTable()
+		tableExists, _ := w.hasMigrationsTable(ctx)
 		assert.False(t, tableExists)
 
 		// correct one command query
 		query := "CREATE TABLE posts (title VARCHAR(255) NOT NULL, PRIMARY KEY(title));"
-		err = w.execMigrationQueries(query, afterFunc)
+		err = w.execMigrationQueries(ctx, query, 0, true, nil, afterFunc)
 		assert.NoError(t, err)
 		var table string
-		err = w.db.QueryRow(w.setPlaceholders(w.provider.hasTableQuery()), "posts").Scan(&table)
+		err = w.db.QueryRow(w.setPlaceholders(w.provider.HasTableQuery()), "posts").Scan(&table)
 		assert.NoError(t, err)
 		assert.Equal(t, "posts", table)
 		w.db.Exec("DROP TABLE posts;")
@@ -170,7 +196,7 @@ func Test_dbWrapper_execMigrationQueries(t *testing.T) {
 			ALTER TABLE posts ADD content TEXT;
 			INSERT INTO posts (title, content) VALUES ('First post', 'And its content');
 		`
-		err = w.execMigrationQueries(query, afterFunc)
+		err = w.execMigrationQueries(ctx, query, 0, true, nil, afterFunc)
 		assert.NoError(t, err)
 		var title string
 		err = w.db.QueryRow("SELECT title FROM posts LIMIT 1").Scan(&title)
@@ -185,7 +211,7 @@ func Test_dbWrapper_execMigrationQueries(t *testing.T) {
 			ERROR;
 			ALTER TABLE posts ADD content TEXT;
 		`
-		err = w.execMigrationQueries(query, afterFunc)
+		err = w.execMigrationQueries(ctx, query, 0, true, nil, afterFunc)
 		assert.Error(t, err)
 		title = ""
 		err = w.db.QueryRow("SELECT title FROM posts LIMIT 1").Scan(&title)
@@ -204,3 +230,114 @@ func Test_dbWrapper_execMigrationQueries(t *testing.T) {
 		w.close()
 	}
 }
+
+func Test_dbWrapper_execMigrationQueries_compoundStatements(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	ctx := context.Background()
+	w := newDBWrapper(&Settings{Engine: "sqlite", Database: "test.db"}, providers["sqlite"])
+	require.NoError(t, w.open())
+	defer w.close()
+
+	afterFunc := func(executor executor) error {
+		return nil
+	}
+
+	query := `
+		CREATE TABLE posts (title VARCHAR(255) NOT NULL, PRIMARY KEY(title));
+		CREATE TABLE log (msg TEXT NOT NULL);
+		CREATE TRIGGER posts_ai AFTER INSERT ON posts
+		BEGIN
+			INSERT INTO log (msg) VALUES ('inserted; ' || NEW.title);
+		END;
+		INSERT INTO posts (title) VALUES ('First; post');
+	`
+	err := w.execMigrationQueries(ctx, query, 0, true, nil, afterFunc)
+	require.NoError(t, err)
+	var msg string
+	err = w.db.QueryRow("SELECT msg FROM log").Scan(&msg)
+	require.NoError(t, err)
+	assert.Equal(t, "inserted; First; post", msg)
+
+	// error points to the failing statement line
+	err = w.execMigrationQueries(ctx, "DROP TABLE log;\n\nERROR;", 0, true, nil, afterFunc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't execute query at line 3 ERROR")
+}
+
+func Test_dbWrapper_execMigrationQueries_withoutTx(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	ctx := context.Background()
+	w := newDBWrapper(&Settings{Engine: "sqlite", Database: "test.db"}, providers["sqlite"])
+	require.NoError(t, w.open())
+	defer w.close()
+
+	afterFuncCalled := false
+	afterFunc := func(executor executor) error {
+		afterFuncCalled = true
+		return nil
+	}
+
+	// first statement is not rolled back and afterFunc is not called
+	query := `
+		CREATE TABLE posts (title VARCHAR(255) NOT NULL, PRIMARY KEY(title));
+		ERROR;
+		CREATE TABLE tags (title VARCHAR(255) NOT NULL, PRIMARY KEY(title));
+	`
+	err := w.execMigrationQueries(ctx, query, 0, false, nil, afterFunc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 3 statements have been executed")
+	assert.Contains(t, err.Error(), "can't execute query at line 3 ERROR")
+	assert.False(t, afterFuncCalled)
+	var table string
+	err = w.db.QueryRow(w.provider.HasTableQuery(), "posts").Scan(&table)
+	assert.NoError(t, err)
+
+	err = w.execMigrationQueries(ctx, "DROP TABLE posts;", 0, false, nil, afterFunc)
+	require.NoError(t, err)
+	assert.True(t, afterFuncCalled)
+
+	// execution is stopped if the executed statement can't be tracked
+	afterFuncCalled = false
+	statementFunc := func(st *Statement, duration time.Duration, rowsAffected int64) error {
+		return errors.New("tracking error")
+	}
+	err = w.execMigrationQueries(ctx, "CREATE TABLE posts (title VARCHAR(255));\nCREATE TABLE tags (title VARCHAR(255));", 0, false, statementFunc, afterFunc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 2 statements have been executed, but the last one can't be tracked")
+	assert.False(t, afterFuncCalled)
+	hasTable, _ := w.hasTable(ctx, "tags")
+	assert.False(t, hasTable)
+
+	// the number of affected rows is not reported for statements which don't change rows
+	var counts []int64
+	statementFunc = func(st *Statement, duration time.Duration, rowsAffected int64) error {
+		counts = append(counts, rowsAffected)
+		return nil
+	}
+	err = w.execMigrationQueries(ctx, "INSERT INTO posts (title) VALUES ('a'), ('b');\nCREATE INDEX posts_title ON posts (title);", 0, false, statementFunc, afterFunc)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, -1}, counts)
+}
+
+func Test_dbWrapper_execMigrationQueries_statementTimeout(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	w := newDBWrapper(&Settings{Engine: "sqlite", Database: "test.db", StatementTimeout: 50 * time.Millisecond}, providers["sqlite"])
+	require.NoError(t, w.open())
+	defer w.close()
+
+	afterFunc := func(executor executor) error { return nil }
+	query := "CREATE TABLE posts (title VARCHAR(255));\n" +
+		"WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000) SELECT COUNT(*) FROM c;"
+	for _, useTx := range []bool{true, false} {
+		err := w.execMigrationQueries(context.Background(), query, 0, useTx, nil, afterFunc)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "statement timeout exceeded while executing query at line 2")
+		w.db.Exec("DROP TABLE IF EXISTS posts")
+	}
+}
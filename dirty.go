@@ -0,0 +1,171 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DirtyState describes the migration which statements have been partially executed and can't be rolled back,
+// because the migration is without transaction or the engine commits DDL statements implicitly.
+// While the database is dirty, migrations are not run, until the state is fixed by Repair
+type DirtyState struct {
+	Version   time.Time
+	Direction Direction
+	// Batch is the batch the migration is recorded with after it is resumed
+	Batch int
+	// ExecutedStatements is the number of statements which have been executed successfully,
+	// i.e. the index of the statement the migration is resumed from
+	ExecutedStatements int
+}
+
+// Dirty returns the state of the partially executed migration, nil if the database is not dirty
+func (m *Migrator) Dirty() (*DirtyState, error) {
+	return m.DirtyContext(context.Background())
+}
+
+// DirtyContext is the same as Dirty, but it can be cancelled using ctx
+func (m *Migrator) DirtyContext(ctx context.Context) (*DirtyState, error) {
+	return m.dbWrapper.dirtyState(ctx)
+}
+
+// Repair fixes the dirty state left by the partially executed migration. If resume is true, the migration is executed
+// from the statement which failed and is recorded if it succeeds, otherwise the dirty state is just cleared,
+// which should be done after the database has been fixed manually
+func (m *Migrator) Repair(resume bool) error {
+	return m.RepairContext(context.Background(), resume)
+}
+
+// RepairContext is the same as Repair, but it can be cancelled using ctx
+func (m *Migrator) RepairContext(ctx context.Context, resume bool) error {
+	err := m.LockContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.Unlock()
+
+	dirty, err := m.dbWrapper.dirtyState(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty == nil {
+		return errors.New("database is not dirty, there is nothing to repair")
+	}
+
+	if !resume {
+		return m.dbWrapper.clearDirtyState(ctx, nil)
+	}
+
+	migration, err := m.getMigration(dirty.Version, dirty.Direction)
+	if err != nil {
+		return errors.Wrap(err, "can't find dirty migration")
+	}
+	query, err := m.readMigration(migration)
+	if err != nil {
+		return err
+	}
+
+	migration.AppliedAt = time.Now().UTC()
+	migration.Batch = dirty.Batch
+	migration.AppliedBy, migration.Host = m.user, m.host
+
+	err = m.observe(migration, func() (bool, error) {
+		return false, m.executeQuery(ctx, migration, query, dirty)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't resume migration %s", migration.FileName())
+	}
+	return nil
+}
+
+// checkDirty returns an error if the database is dirty, so migrations are not run until it is repaired
+func (m *Migrator) checkDirty(ctx context.Context) error {
+	dirty, err := m.dbWrapper.dirtyState(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty != nil {
+		return errors.Errorf("database is dirty, %s migration with version %s failed after %d statements had been executed, "+
+			"resume or clear it using repair", dirty.Direction, dirty.Version.Format(TimestampFormat), dirty.ExecutedStatements)
+	}
+	return nil
+}
+
+// dirtyTable returns the name of the table holding the dirty state, qualified with the schema if it is set
+func (w *dbWrapper) dirtyTable() string {
+	return w.qualifiedTable(w.MigrationsTable + "_dirty")
+}
+
+// createDirtyTable creates the table holding the dirty state, version 7 of the migrations table schema,
+// if it does not exist yet, e.g. if it was left by the process which crashed while creating tables
+func (w *dbWrapper) createDirtyTable(ctx context.Context) error {
+	_, err := w.db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version VARCHAR(14) NOT NULL, direction VARCHAR(4) NOT NULL, "+
+		"batch INTEGER, executed_statements INTEGER NOT NULL);", w.dirtyTable()))
+	if err != nil {
+		return errors.Wrap(err, "can't create dirty state table")
+	}
+	return nil
+}
+
+// dirtyState returns the dirty state, nil if the database is not dirty
+func (w *dbWrapper) dirtyState(ctx context.Context) (*DirtyState, error) {
+	var version, direction string
+	var batch sql.NullInt64
+	state := &DirtyState{}
+	err := w.db.QueryRowContext(ctx, fmt.Sprintf("SELECT version, direction, batch, executed_statements FROM %s", w.dirtyTable())).
+		Scan(&version, &direction, &batch, &state.ExecutedStatements)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get dirty state")
+	}
+
+	state.Version, _ = time.Parse(TimestampFormat, version)
+	state.Direction, _ = DirectionFromString(direction)
+	state.Batch = int(batch.Int64)
+	return state, nil
+}
+
+// insertDirtyState records the dirty state before the migration is executed. It doesn't take a context,
+// because executed statements must be tracked even if the operation has been cancelled
+func (w *dbWrapper) insertDirtyState(state *DirtyState) error {
+	_, err := w.db.ExecContext(context.Background(), w.setPlaceholders(fmt.Sprintf(
+		"INSERT INTO %s (version, direction, batch, executed_statements) VALUES (?, ?, ?, ?)", w.dirtyTable())),
+		state.Version.UTC().Format(TimestampFormat), state.Direction.String(), state.Batch, state.ExecutedStatements)
+	if err != nil {
+		return errors.Wrap(err, "can't set dirty state")
+	}
+	return nil
+}
+
+// updateDirtyState updates the number of executed statements of the dirty state using the single statement,
+// so the state is never lost, even if the process crashes
+func (w *dbWrapper) updateDirtyState(state *DirtyState) error {
+	result, err := w.db.ExecContext(context.Background(), w.setPlaceholders(fmt.Sprintf(
+		"UPDATE %s SET executed_statements = ? WHERE version = ?", w.dirtyTable())),
+		state.ExecutedStatements, state.Version.UTC().Format(TimestampFormat))
+	if err != nil {
+		return errors.Wrap(err, "can't update dirty state")
+	}
+	if n, err := result.RowsAffected(); err == nil && n != 1 {
+		return errors.Errorf("can't update dirty state, it has %d rows for version %s", n, state.Version.Format(TimestampFormat))
+	}
+	return nil
+}
+
+// clearDirtyState removes the dirty state
+func (w *dbWrapper) clearDirtyState(ctx context.Context, executor executor) error {
+	if executor == nil {
+		executor = w.db
+	}
+
+	_, err := executor.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", w.dirtyTable()))
+	if err != nil {
+		return errors.Wrap(err, "can't clear dirty state")
+	}
+	return nil
+}
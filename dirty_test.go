@@ -0,0 +1,123 @@
+package dbmigrate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Migrator_Repair(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	err := m.Repair(true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database is not dirty")
+
+	// the failed first statement doesn't make the database dirty
+	fpath := filepath.Join(MigrationsDir, "20180918202020.no_transaction.up.sql")
+	ioutil.WriteFile(fpath, []byte("-- dbmigrate:no-transaction\nERROR;"), 0644)
+	defer os.Remove(fpath)
+	migration, _ := migrationFromFileName(filepath.Base(fpath))
+	require.Error(t, m.run(context.Background(), migration))
+	dirty, err := m.Dirty()
+	require.NoError(t, err)
+	assert.Nil(t, dirty)
+
+	ioutil.WriteFile(fpath, []byte("-- dbmigrate:no-transaction\nCREATE TABLE users (name VARCHAR NOT NULL);\nERROR;\nCREATE TABLE tags (name VARCHAR NOT NULL);"), 0644)
+	migration.Batch = 1
+	require.Error(t, m.run(context.Background(), migration))
+	dirty, err = m.Dirty()
+	require.NoError(t, err)
+	require.NotNil(t, dirty)
+	assert.Equal(t, migration.Version, dirty.Version)
+	assert.Equal(t, DirectionUp, dirty.Direction)
+	assert.Equal(t, 1, dirty.Batch)
+	assert.Equal(t, 1, dirty.ExecutedStatements)
+
+	_, err = m.Migrate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database is dirty")
+
+	// the migration is resumed from the failed statement, so the first one is not executed again
+	ioutil.WriteFile(fpath, []byte("-- dbmigrate:no-transaction\nCREATE TABLE users (name VARCHAR NOT NULL);\nCREATE TABLE posts (name VARCHAR NOT NULL);\nCREATE TABLE tags (name VARCHAR NOT NULL);"), 0644)
+	require.NoError(t, m.Repair(true))
+	dirty, err = m.Dirty()
+	require.NoError(t, err)
+	assert.Nil(t, dirty)
+	for _, table := range []string{"users", "posts", "tags"} {
+		hasTable, _ := m.dbWrapper.hasTable(context.Background(), table)
+		assert.True(t, hasTable)
+	}
+	migrations, _ := m.Status()
+	last := migrations[len(migrations)-1]
+	assert.Equal(t, migration.Version, last.Version)
+	assert.Equal(t, 1, last.Batch)
+}
+
+// nonTransactionalDDLProvider is the sqlite provider pretending its engine commits DDL statements implicitly
+type nonTransactionalDDLProvider struct {
+	Provider
+}
+
+// SplitStatements appends COMMIT to DDL statements, ending the transaction the same way as engines without transactional DDL do,
+// sqlite can't commit outside transaction, so it is used with migrations having the single DDL statement
+func (p *nonTransactionalDDLProvider) SplitStatements(query string) ([]*Statement, error) {
+	statements, err := p.Provider.SplitStatements(query)
+	for _, st := range statements {
+		if isDDL(st.Query) {
+			st.Query += ";\nCOMMIT"
+		}
+	}
+	return statements, err
+}
+
+func Test_Migrator_run_nonTransactionalDDL(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+	m.dbWrapper.provider = &nonTransactionalDDLProvider{m.dbWrapper.provider}
+
+	fpath := filepath.Join(MigrationsDir, "20180918202020.create_users.up.sql")
+	ioutil.WriteFile(fpath, []byte("CREATE TABLE users (name VARCHAR NOT NULL);\nINSERT INTO users (name) VALUES ('admin');\nERROR;"), 0644)
+	defer os.Remove(fpath)
+	migration, _ := migrationFromFileName(filepath.Base(fpath))
+	migration.Batch = 1
+
+	// DDL statement ends the transaction, so it and all following statements are committed and tracked
+	require.Error(t, m.run(context.Background(), migration))
+	dirty, err := m.Dirty()
+	require.NoError(t, err)
+	require.NotNil(t, dirty)
+	assert.Equal(t, migration.Version, dirty.Version)
+	assert.Equal(t, 2, dirty.ExecutedStatements)
+	var count int
+	require.NoError(t, m.dbWrapper.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count))
+	assert.Equal(t, 1, count)
+
+	_, err = m.Migrate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database is dirty")
+
+	// engines with transactional DDL roll back all statements, so the migration is not tracked
+	require.NoError(t, m.Repair(false))
+	_, err = m.dbWrapper.db.Exec("DROP TABLE users")
+	require.NoError(t, err)
+	m.dbWrapper.provider = &sqliteProvider{}
+	require.Error(t, m.run(context.Background(), migration))
+	dirty, err = m.Dirty()
+	require.NoError(t, err)
+	assert.Nil(t, dirty)
+	hasTable, _ := m.dbWrapper.hasTable(context.Background(), "users")
+	assert.False(t, hasTable)
+}
@@ -0,0 +1,72 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// GoMigrationFunc is the function of the Go migration, it is executed inside the transaction
+// which also records the migration in the migrations table
+type GoMigrationFunc func(ctx context.Context, tx *sql.Tx) error
+
+// goMigration holds functions of the registered Go migration
+type goMigration struct {
+	name string
+	up   GoMigrationFunc
+	down GoMigrationFunc
+}
+
+// goMigrations is the map where keys are versions in TimestampFormat and values are registered Go migrations
+var goMigrations = make(map[string]*goMigration)
+
+// Register registers Go migration with the given version in TimestampFormat and name,
+// so it is applied and rolled back together with migrations files, ordered by version.
+// down can be nil, which means that there is no down migration.
+// It is intended to be called from init functions and panics if arguments are incorrect or the version is already registered
+func Register(version string, name string, up GoMigrationFunc, down GoMigrationFunc) {
+	ts, err := time.Parse(TimestampFormat, version)
+	if err != nil || len(version) != len(TimestampFormat) {
+		panic(fmt.Sprintf("dbmigrate: can't register Go migration, incorrect version %s", version))
+	}
+	name = regexp.MustCompile(`\s+`).ReplaceAllString(strings.TrimSpace(strings.ToLower(name)), "_")
+	if name == "" {
+		panic(fmt.Sprintf("dbmigrate: can't register Go migration with version %s, name is empty", version))
+	}
+	if up == nil {
+		panic(fmt.Sprintf("dbmigrate: can't register Go migration %s, up function is nil", name))
+	}
+	if _, ok := goMigrations[ts.Format(TimestampFormat)]; ok {
+		panic(fmt.Sprintf("dbmigrate: Go migration with version %s is already registered", version))
+	}
+
+	goMigrations[ts.Format(TimestampFormat)] = &goMigration{name: name, up: up, down: down}
+}
+
+// registeredGoMigrations returns registered Go migrations for the given direction
+func registeredGoMigrations(direction Direction) []*Migration {
+	var migrations []*Migration
+	for version, gm := range goMigrations {
+		if direction == DirectionDown && gm.down == nil {
+			continue
+		}
+		ts, _ := time.Parse(TimestampFormat, version)
+		migrations = append(migrations, &Migration{Version: ts, Name: gm.name, Direction: direction, Go: true})
+	}
+	return migrations
+}
+
+// goMigrationFunc returns the function of the registered Go migration
+func goMigrationFunc(migration *Migration) GoMigrationFunc {
+	gm, ok := goMigrations[migration.Version.Format(TimestampFormat)]
+	if !ok {
+		return nil
+	}
+	if migration.Direction == DirectionDown {
+		return gm.down
+	}
+	return gm.up
+}
@@ -0,0 +1,100 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Register(t *testing.T) {
+	fn := func(ctx context.Context, tx *sql.Tx) error { return nil }
+
+	assert.PanicsWithValue(t, "dbmigrate: can't register Go migration, incorrect version 2018", func() { Register("2018", "name", fn, fn) })
+	assert.PanicsWithValue(t, "dbmigrate: can't register Go migration with version 20180918200500, name is empty", func() {
+		Register("20180918200500", " ", fn, fn)
+	})
+	assert.PanicsWithValue(t, "dbmigrate: can't register Go migration rehash_passwords, up function is nil", func() {
+		Register("20180918200500", "Rehash passwords", nil, fn)
+	})
+
+	Register("20180918200500", "Rehash passwords", fn, nil)
+	defer delete(goMigrations, "20180918200500")
+	assert.Equal(t, "rehash_passwords", goMigrations["20180918200500"].name)
+	assert.PanicsWithValue(t, "dbmigrate: Go migration with version 20180918200500 is already registered", func() {
+		Register("20180918200500", "other", fn, nil)
+	})
+
+	migrations := registeredGoMigrations(DirectionUp)
+	require.Len(t, migrations, 1)
+	assert.Equal(t, "20180918200500.rehash_passwords.up.go", migrations[0].FileName())
+	assert.NotNil(t, goMigrationFunc(migrations[0]))
+	assert.Empty(t, registeredGoMigrations(DirectionDown))
+}
+
+func Test_Migrator_goMigrations(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	// the migration is placed between the migrations creating posts and authors tables
+	Register("20180918200500", "add first post", func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO posts (title, content) VALUES ('first', 'post')")
+		return err
+	}, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM posts WHERE title = 'first'")
+		return err
+	})
+	defer delete(goMigrations, "20180918200500")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	migrations, err := m.findMigrations(DirectionUp)
+	require.NoError(t, err)
+	require.Len(t, migrations, 4)
+	assert.True(t, migrations[1].Go)
+
+	migration, err := m.getMigration(time.Date(2018, 9, 18, 20, 5, 0, 0, time.UTC), DirectionDown)
+	require.NoError(t, err)
+	assert.Equal(t, "20180918200500.add_first_post.down.go", migration.FileName())
+
+	plan, err := m.Plan(DirectionUp, 2)
+	require.NoError(t, err)
+	assert.Len(t, plan.Steps[1].Statements, 2)
+
+	n, err := m.MigrateSteps(2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	var count int
+	m.dbWrapper.db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&count)
+	assert.Equal(t, 1, count)
+
+	v, err := m.Verify()
+	require.NoError(t, err)
+	assert.False(t, v.HasDrift())
+
+	n, err = m.RollbackSteps(1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	m.dbWrapper.db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&count)
+	assert.Equal(t, 0, count)
+
+	// failed Go migration is rolled back with its migrations table row
+	goMigrations["20180918200500"].up = func(ctx context.Context, tx *sql.Tx) error {
+		tx.ExecContext(ctx, "INSERT INTO posts (title, content) VALUES ('first', 'post')")
+		return errors.New("can't reshape")
+	}
+	_, err = m.Migrate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't reshape")
+	m.dbWrapper.db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&count)
+	assert.Equal(t, 0, count)
+	lm, _ := m.LatestVersionMigration()
+	assert.Equal(t, time.Date(2018, 9, 18, 20, 4, 53, 0, time.UTC), lm.Version)
+}
@@ -0,0 +1,177 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HistoryEntry is the record of the migration execution, it is appended to the history table for every execution,
+// successful or not, and is never changed or removed, unlike the migrations table row
+type HistoryEntry struct {
+	ID        int
+	Version   time.Time
+	Name      string
+	Direction Direction
+	// ExecutedAt is the time the execution finished
+	ExecutedAt time.Time
+	Duration   time.Duration
+	// Batch is the number of migrate operation the migration was applied during
+	Batch int
+	// Manual specifies if the migration was marked as applied or unapplied without execution
+	Manual bool
+	// Error is the error text of the failed execution, empty if it succeeded
+	Error            string
+	ExecutedBy       string
+	Host             string
+	DbmigrateVersion string
+}
+
+// Failed returns true if the execution failed
+func (e *HistoryEntry) Failed() bool {
+	return e.Error != ""
+}
+
+// HistoryFilter specifies which history entries are returned by History, zero fields match all entries
+type HistoryFilter struct {
+	// Version of the migration
+	Version time.Time
+	// Since and Until limit execution times, Since is inclusive and Until is exclusive
+	Since time.Time
+	Until time.Time
+}
+
+// History returns history entries matching the filter, which can be nil, ordered by execution time
+func (m *Migrator) History(filter *HistoryFilter) ([]*HistoryEntry, error) {
+	return m.HistoryContext(context.Background(), filter)
+}
+
+// HistoryContext is the same as History, but it can be cancelled using ctx
+func (m *Migrator) HistoryContext(ctx context.Context, filter *HistoryFilter) ([]*HistoryEntry, error) {
+	if filter == nil {
+		filter = &HistoryFilter{}
+	}
+	entries, err := m.dbWrapper.historyEntries(ctx, filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get history")
+	}
+	return entries, nil
+}
+
+// historyEntry returns the history entry of the migration execution, err is the execution error if it failed
+func (m *Migrator) historyEntry(migration *Migration, duration time.Duration, err error) *HistoryEntry {
+	entry := &HistoryEntry{
+		Version: migration.Version, Name: migration.Name, Direction: migration.Direction, ExecutedAt: time.Now().UTC(),
+		Duration: duration, Batch: migration.Batch, ExecutedBy: m.user, Host: m.host, DbmigrateVersion: Version,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// historyTable returns the name of the table holding the history of migrations executions, qualified with the schema if it is set
+func (w *dbWrapper) historyTable() string {
+	return w.qualifiedTable(w.MigrationsTable + "_history")
+}
+
+// createHistoryTable creates the history table, version 5 of the migrations table schema,
+// if it does not exist yet, e.g. if it was left by the process which crashed while creating tables
+func (w *dbWrapper) createHistoryTable(ctx context.Context) error {
+	_, err := w.db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id %s, version VARCHAR(14) NOT NULL, name VARCHAR(255) NOT NULL, "+
+		"direction VARCHAR(4) NOT NULL, executed_at %s NOT NULL, duration_ms INTEGER, batch INTEGER, manual INTEGER NOT NULL, error TEXT, "+
+		"executed_by VARCHAR(255), host VARCHAR(255), dbmigrate_version VARCHAR(32));",
+		w.historyTable(), w.provider.SerialPrimaryKeyType(), w.provider.TimestampType()))
+	if err != nil {
+		return errors.Wrap(err, "can't create history table")
+	}
+	return nil
+}
+
+// insertHistoryEntry appends the entry to the history table
+func (w *dbWrapper) insertHistoryEntry(ctx context.Context, entry *HistoryEntry, executor executor) error {
+	if executor == nil {
+		executor = w.db
+	}
+
+	query, args := w.insertHistoryEntryQuery(entry)
+	_, err := executor.ExecContext(ctx, w.setPlaceholders(query), args...)
+	if err != nil {
+		return errors.Wrap(err, "can't insert history entry")
+	}
+	return nil
+}
+
+// insertHistoryEntryQuery returns the query, with ? placeholders, and its args used to append the entry to the history table
+func (w *dbWrapper) insertHistoryEntryQuery(entry *HistoryEntry) (string, []interface{}) {
+	manual := 0
+	if entry.Manual {
+		manual = 1
+	}
+	return fmt.Sprintf("INSERT INTO %s (version, name, direction, executed_at, duration_ms, batch, manual, error, executed_by, host, dbmigrate_version) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", w.historyTable()),
+		[]interface{}{
+			entry.Version.UTC().Format(TimestampFormat), entry.Name, entry.Direction.String(), entry.ExecutedAt.UTC().Format(dbTimestampFormat),
+			int64(entry.Duration / time.Millisecond), entry.Batch, manual, sql.NullString{String: entry.Error, Valid: entry.Error != ""},
+			entry.ExecutedBy, entry.Host, entry.DbmigrateVersion,
+		}
+}
+
+// historyEntries returns entries of the history table matching the filter, ordered by id, i.e. by execution time
+func (w *dbWrapper) historyEntries(ctx context.Context, filter *HistoryFilter) ([]*HistoryEntry, error) {
+	var conditions []string
+	var args []interface{}
+	if !filter.Version.IsZero() {
+		conditions = append(conditions, "version = ?")
+		args = append(args, filter.Version.UTC().Format(TimestampFormat))
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "executed_at >= ?")
+		args = append(args, filter.Since.UTC().Format(dbTimestampFormat))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "executed_at < ?")
+		args = append(args, filter.Until.UTC().Format(dbTimestampFormat))
+	}
+
+	query := fmt.Sprintf("SELECT id, version, name, direction, executed_at, duration_ms, batch, manual, error, executed_by, host, dbmigrate_version "+
+		"FROM %s", w.historyTable())
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id ASC"
+
+	rows, err := w.db.QueryContext(ctx, w.setPlaceholders(query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't select history entries")
+	}
+	defer rows.Close()
+
+	var entries []*HistoryEntry
+	for rows.Next() {
+		var version, direction string
+		var duration, batch sql.NullInt64
+		var manual int
+		var errorText, executedBy, host, dbmigrateVersion sql.NullString
+		entry := &HistoryEntry{}
+		err = rows.Scan(&entry.ID, &version, &entry.Name, &direction, &entry.ExecutedAt, &duration, &batch, &manual,
+			&errorText, &executedBy, &host, &dbmigrateVersion)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan history table's row")
+		}
+
+		entry.Version, _ = time.Parse(TimestampFormat, version)
+		entry.Direction, _ = DirectionFromString(direction)
+		entry.ExecutedAt = entry.ExecutedAt.UTC()
+		entry.Duration = time.Duration(duration.Int64) * time.Millisecond
+		entry.Batch = int(batch.Int64)
+		entry.Manual = manual != 0
+		entry.Error, entry.ExecutedBy, entry.Host, entry.DbmigrateVersion = errorText.String, executedBy.String, host.String, dbmigrateVersion.String
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,72 @@
+package dbmigrate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Migrator_History(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	entries, err := m.History(nil)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = m.MigrateSteps(1)
+	require.NoError(t, err)
+	_, err = m.Rollback()
+	require.NoError(t, err)
+	_, err = m.MigrateSteps(1)
+	require.NoError(t, err)
+
+	fpath := filepath.Join(MigrationsDir, "20180918202020.failing.up.sql")
+	ioutil.WriteFile(fpath, []byte("ERROR;"), 0644)
+	defer os.Remove(fpath)
+	_, err = m.MigrateTo(time.Date(2018, 9, 18, 20, 20, 20, 0, time.UTC))
+	require.Error(t, err)
+
+	// rollback removes the row of the migrations table, but history entries are kept
+	entries, err = m.History(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 6)
+	version := time.Date(2018, 9, 18, 20, 4, 53, 0, time.UTC)
+	assert.Equal(t, []Direction{DirectionUp, DirectionDown, DirectionUp}, []Direction{entries[0].Direction, entries[1].Direction, entries[2].Direction})
+	for i, entry := range entries[:3] {
+		assert.Equal(t, i+1, entry.ID)
+		assert.Equal(t, version, entry.Version)
+		assert.Equal(t, "correct", entry.Name)
+		assert.Equal(t, 1, entry.Batch)
+		assert.False(t, entry.Failed())
+		assert.False(t, entry.Manual)
+		assert.Equal(t, m.user, entry.ExecutedBy)
+		assert.Equal(t, m.host, entry.Host)
+		assert.Equal(t, Version, entry.DbmigrateVersion)
+		assert.WithinDuration(t, time.Now(), entry.ExecutedAt, time.Minute)
+	}
+	assert.Equal(t, "failing", entries[5].Name)
+	assert.True(t, entries[5].Failed())
+	assert.Contains(t, entries[5].Error, "ERROR")
+
+	entries, err = m.History(&HistoryFilter{Version: version})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	entries, err = m.HistoryContext(context.Background(), &HistoryFilter{Since: time.Now().Add(-time.Hour), Until: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Len(t, entries, 6)
+
+	entries, err = m.History(&HistoryFilter{Until: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,132 @@
+package dbmigrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MarkApplied records the migration with the given version as applied without executing it,
+// e.g. if its changes have been made by hand. The migration is recorded as a new batch
+// and the manual action is appended to the history
+func (m *Migrator) MarkApplied(version time.Time) error {
+	return m.MarkAppliedContext(context.Background(), version)
+}
+
+// MarkAppliedContext is the same as MarkApplied, but it can be cancelled using ctx
+func (m *Migrator) MarkAppliedContext(ctx context.Context, version time.Time) error {
+	err := m.LockContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.Unlock()
+
+	migration, err := m.getMigration(version, DirectionUp)
+	if err != nil {
+		return errors.Wrap(err, "can't find migration to mark as applied")
+	}
+
+	md, err := m.dbWrapper.appliedMigrationData(ctx, version)
+	if err != nil {
+		return err
+	}
+	if md != nil {
+		return errors.Errorf("migration %s is already applied", migration.FileName())
+	}
+
+	batch, err := m.dbWrapper.lastBatch(ctx)
+	if err != nil {
+		return err
+	}
+	migration.AppliedAt = time.Now().UTC()
+	migration.Batch = batch + 1
+
+	tx, err := m.dbWrapper.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can't begin transaction")
+	}
+	defer tx.Rollback()
+
+	err = m.recordApplied(ctx, migration, tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MarkUnapplied removes the migration with the given version from applied ones without rolling it back,
+// e.g. if it failed half way on the database without transactional DDL. The manual action is appended to the history
+func (m *Migrator) MarkUnapplied(version time.Time) error {
+	return m.MarkUnappliedContext(context.Background(), version)
+}
+
+// MarkUnappliedContext is the same as MarkUnapplied, but it can be cancelled using ctx
+func (m *Migrator) MarkUnappliedContext(ctx context.Context, version time.Time) error {
+	err := m.LockContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.Unlock()
+
+	// down migration is not required, since it is not executed
+	migration, err := m.getMigration(version, DirectionUp)
+	if err != nil {
+		return errors.Wrap(err, "can't find migration to mark as unapplied")
+	}
+	migration.Direction = DirectionDown
+
+	md, err := m.dbWrapper.appliedMigrationData(ctx, version)
+	if err != nil {
+		return err
+	}
+	if md == nil {
+		return errors.Errorf("migration %s is not applied", migration.FileName())
+	}
+	migration.Batch = md.batch
+
+	tx, err := m.dbWrapper.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can't begin transaction")
+	}
+	defer tx.Rollback()
+
+	err = m.dbWrapper.deleteMigrationVersion(ctx, migration.Version, tx)
+	if err != nil {
+		return errors.Wrapf(err, "can't mark migration %s as unapplied", migration.FileName())
+	}
+	entry := m.historyEntry(migration, 0, nil)
+	entry.Manual = true
+	err = m.dbWrapper.insertHistoryEntry(ctx, entry, tx)
+	if err != nil {
+		return errors.Wrapf(err, "can't mark migration %s as unapplied", migration.FileName())
+	}
+	return tx.Commit()
+}
+
+// recordApplied inserts data of the up migration, which is not executed, and the manual history entry,
+// checksum of the migration file is recorded, so it can be verified as well as executed migrations
+func (m *Migrator) recordApplied(ctx context.Context, migration *Migration, executor executor) error {
+	var sum string
+	if !migration.Go {
+		query, err := m.readMigration(migration)
+		if err != nil {
+			return err
+		}
+		sum = migrationChecksum(migration, query)
+	}
+
+	migration.AppliedBy, migration.Host = m.user, m.host
+	err := m.dbWrapper.insertMigrationData(ctx, m.migrationData(migration, sum), executor)
+	if err != nil {
+		return errors.Wrapf(err, "can't mark migration %s as applied", migration.FileName())
+	}
+
+	entry := m.historyEntry(migration, 0, nil)
+	entry.Manual = true
+	err = m.dbWrapper.insertHistoryEntry(ctx, entry, executor)
+	if err != nil {
+		return errors.Wrapf(err, "can't mark migration %s as applied", migration.FileName())
+	}
+	return nil
+}
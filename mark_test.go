@@ -0,0 +1,60 @@
+package dbmigrate
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Migrator_MarkApplied_MarkUnapplied(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	v1 := time.Date(2018, 9, 18, 20, 4, 53, 0, time.UTC)
+	v2 := time.Date(2018, 9, 18, 20, 6, 32, 0, time.UTC)
+
+	err := m.MarkApplied(time.Date(2018, 9, 18, 20, 5, 0, 0, time.UTC))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't find migration to mark as applied")
+
+	m.MigrateSteps(1)
+	err = m.MarkApplied(v1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is already applied")
+
+	require.NoError(t, m.MarkApplied(v2))
+	migrations, _ := m.Status()
+	assert.Equal(t, 2, migrations[1].Batch)
+	assert.False(t, migrations[1].Baselined)
+	v, err := m.Verify()
+	require.NoError(t, err)
+	assert.False(t, v.HasDrift())
+
+	require.NoError(t, m.MarkUnapplied(v2))
+	err = m.MarkUnapplied(v2)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not applied")
+
+	// the migration, which was executed, is only removed from the migrations table
+	require.NoError(t, m.MarkUnapplied(v1))
+	hasTable, _ := m.dbWrapper.hasTable(context.Background(), "posts")
+	assert.True(t, hasTable)
+	lm, _ := m.LastAppliedMigration()
+	assert.Nil(t, lm)
+
+	entries, err := m.History(&HistoryFilter{Version: v2})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.True(t, entries[0].Manual)
+	assert.Equal(t, DirectionUp, entries[0].Direction)
+	assert.True(t, entries[1].Manual)
+	assert.Equal(t, DirectionDown, entries[1].Direction)
+	assert.Equal(t, 2, entries[1].Batch)
+}
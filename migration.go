@@ -1,6 +1,7 @@
 package dbmigrate
 
 import (
+	"bytes"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -17,6 +18,43 @@ type Migration struct {
 	AppliedAt time.Time
 	Direction Direction
 	Engine    string
+	// Batch is the number of migrate operation the migration was applied during, 0 if it is not applied
+	Batch int
+	// Duration is the time it took to apply the migration
+	Duration time.Duration
+	// AppliedBy and Host are the OS user and the host which applied the migration.
+	// They are empty, as well as Duration, for migrations applied by older dbmigrate versions
+	AppliedBy string
+	Host      string
+	// Baselined specifies if the migration was recorded as applied by Baseline without execution
+	Baselined bool
+	// Go specifies if the migration is the Go function registered using Register instead of the file
+	Go bool
+	// SingleFile specifies if the migration file holds both up and down sections
+	SingleFile bool
+}
+
+const (
+	// upSectionMarker starts the up section of single-file migration
+	upSectionMarker = "-- +migrate up"
+	// downSectionMarker starts the down section of single-file migration
+	downSectionMarker = "-- +migrate down"
+)
+
+// Verification holds the differences between applied migrations and the migrations files
+type Verification struct {
+	// Changed are applied migrations which files have been edited after they were applied
+	Changed []*Migration
+	// Missing are applied migrations which files do not exist anymore, only their versions and applied at times are known
+	Missing []*Migration
+	// Unknown are not applied migrations which are older than the latest applied one,
+	// e.g. they were added to the history after newer migrations had been applied
+	Unknown []*Migration
+}
+
+// HasDrift returns true if applied migrations differ from the migrations files
+func (v *Verification) HasDrift() bool {
+	return len(v.Changed) > 0 || len(v.Missing) > 0 || len(v.Unknown) > 0
 }
 
 type byVersion []*Migration
@@ -25,13 +63,21 @@ func (bv byVersion) Len() int           { return len(bv) }
 func (bv byVersion) Swap(i, j int)      { bv[i], bv[j] = bv[j], bv[i] }
 func (bv byVersion) Less(i, j int) bool { return bv[i].Version.Unix() < bv[j].Version.Unix() }
 
-// FileName builds migration file name from metadata
+// FileName builds migration file name from metadata, Go migrations have the go extension
+// and single-file migrations have no direction
 func (m *Migration) FileName() string {
-	parts := []string{m.Version.Format(TimestampFormat), m.Name, m.Direction.String()}
+	parts := []string{m.Version.Format(TimestampFormat), m.Name}
+	if !m.SingleFile {
+		parts = append(parts, m.Direction.String())
+	}
 	if m.Engine != "" {
 		parts = append(parts, m.Engine)
 	}
-	parts = append(parts, "sql")
+	if m.Go {
+		parts = append(parts, "go")
+	} else {
+		parts = append(parts, "sql")
+	}
 
 	return strings.Join(parts, ".")
 }
@@ -41,7 +87,8 @@ func (m *Migration) HumanName() string {
 	return strings.Replace(m.Name, "_", " ", -1)
 }
 
-// migrationFromFileName tries to parse migration metadata from the filename
+// migrationFromFileName tries to parse migration metadata from the filename,
+// which is either version.name.direction(.engine).sql or version.name(.engine).sql for single-file migrations
 func migrationFromFileName(fname string) (*Migration, error) {
 	errMsg := fmt.Sprintf("can't parse migration from filename %s", fname)
 
@@ -56,21 +103,98 @@ func migrationFromFileName(fname string) (*Migration, error) {
 		return nil, errors.Wrap(err, errMsg)
 	}
 
-	name := parts[1]
-
-	direction, err := DirectionFromString(parts[2])
-	if err != nil {
-		return nil, errors.Wrap(err, errMsg)
+	if len(parts) < 3 {
+		return nil, errors.Errorf("%s, name is missing", errMsg)
+	}
+	migration := &Migration{Version: ts, Name: parts[1]}
+
+	// parts between the name and the extension
+	rest := parts[2 : len(parts)-1]
+	if len(rest) > 0 {
+		if direction, err := DirectionFromString(rest[0]); err == nil {
+			migration.Direction = direction
+			rest = rest[1:]
+		}
+	}
+	// file without direction holds both up and down sections
+	if migration.Direction == directionError {
+		migration.SingleFile = true
 	}
 
 	// engine specific migration
-	var engine string
-	if len(parts) > 4 {
-		if _, ok := providers[strings.ToLower(parts[3])]; !ok {
+	if len(rest) > 1 {
+		return nil, errors.Errorf("%s, too many parts", errMsg)
+	}
+	if len(rest) == 1 {
+		if _, ok := providerByName(strings.ToLower(rest[0])); !ok {
 			return nil, errors.Errorf("%s, engine is not known", errMsg)
 		}
-		engine = strings.ToLower(parts[3])
+		migration.Engine = strings.ToLower(rest[0])
+	}
+
+	return migration, nil
+}
+
+// sectionMarker checks if the line of single-file migration starts the up or down section
+func sectionMarker(line string) (Direction, bool) {
+	fields := strings.Fields(strings.ToLower(line))
+	if len(fields) != 3 || fields[0] != "--" || fields[1] != "+migrate" {
+		return directionError, false
+	}
+	direction, err := DirectionFromString(fields[2])
+	if err != nil {
+		return directionError, false
+	}
+	return direction, true
+}
+
+// migrationSection returns the section of single-file migration for the given direction.
+// Lines preceding the section are replaced with empty ones, so line numbers of statements are the same as in the file.
+// Missing down section is returned as empty one, so it is treated the same way as empty down migration file
+func migrationSection(content []byte, direction Direction) ([]byte, error) {
+	lines := strings.Split(string(content), "\n")
+
+	current := directionError
+	found := map[Direction]bool{}
+	start := 0
+	var section []string
+	for i, line := range lines {
+		if d, ok := sectionMarker(line); ok {
+			if found[d] {
+				return nil, errors.Errorf("line %d: duplicated %s section", i+1, d)
+			}
+			found[d] = true
+			current = d
+			if d == direction {
+				start = i + 1
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if current == directionError && trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			return nil, errors.Errorf("line %d: statement before the first %s or %s marker", i+1, upSectionMarker, downSectionMarker)
+		}
+		if current == direction {
+			section = append(section, line)
+		}
+	}
+
+	if !found[direction] {
+		if direction == DirectionUp {
+			return nil, errors.Errorf("there is no %s section", direction)
+		}
+		return nil, nil
 	}
 
-	return &Migration{Version: ts, Name: name, Direction: direction, Engine: engine}, nil
+	return []byte(strings.Repeat("\n", start) + strings.Join(section, "\n")), nil
+}
+
+// migrationChecksum returns checksum of the migration query. Empty lines padding the section of single-file migration
+// are not included, so changes of the other section don't change the checksum
+func migrationChecksum(migration *Migration, query []byte) string {
+	if migration.SingleFile {
+		query = bytes.TrimLeft(query, "\n")
+	}
+	return checksum(query)
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_byVersion(t *testing.T) {
@@ -24,6 +25,9 @@ func Test_Migration_FileName(t *testing.T) {
 
 	m.Engine = "postgres"
 	assert.Equal(t, "20100607080910.test_migration.up.postgres.sql", m.FileName())
+
+	m.SingleFile = true
+	assert.Equal(t, "20100607080910.test_migration.postgres.sql", m.FileName())
 }
 
 func Test_Migration_HumanName(t *testing.T) {
@@ -38,6 +42,8 @@ func Test_migrationFromFileName(t *testing.T) {
 		"201000607080910.test_migration.up.sql",
 		"20100607080910.test_migration.upp.sql",
 		"20100607080910.test_migration.up.msql.sql",
+		"20100607080910.sql",
+		"20100607080910.test_migration.up.postgres.other.sql",
 	}
 	for _, fname := range incorrectNames {
 		_, err := migrationFromFileName(fname)
@@ -68,3 +74,73 @@ func Test_migrationFromFileName(t *testing.T) {
 		}
 	}
 }
+
+func Test_migrationFromFileName_singleFile(t *testing.T) {
+	m, err := migrationFromFileName("20100607080910.test_migration.sql")
+	require.NoError(t, err)
+	assert.Equal(t, &Migration{Version: time.Date(2010, 6, 7, 8, 9, 10, 0, time.UTC), Name: "test_migration", SingleFile: true}, m)
+
+	m, err = migrationFromFileName("20100607080910.test_migration.Postgres.sql")
+	require.NoError(t, err)
+	assert.True(t, m.SingleFile)
+	assert.Equal(t, "postgres", m.Engine)
+
+	_, err = migrationFromFileName("20100607080910.test_migration.msql.sql")
+	assert.Error(t, err)
+}
+
+func Test_sectionMarker(t *testing.T) {
+	direction, ok := sectionMarker("-- +migrate up")
+	assert.True(t, ok)
+	assert.Equal(t, DirectionUp, direction)
+
+	direction, ok = sectionMarker("  --   +Migrate Down ")
+	assert.True(t, ok)
+	assert.Equal(t, DirectionDown, direction)
+
+	for _, line := range []string{"-- migrate up", "-- +migrate", "-- +migrate sideways", "SELECT 1; -- +migrate up"} {
+		_, ok = sectionMarker(line)
+		assert.False(t, ok, line)
+	}
+}
+
+func Test_migrationSection(t *testing.T) {
+	content := []byte("-- comment\n-- +migrate up\nCREATE TABLE t (a INT);\n-- +migrate down\nDROP TABLE t;")
+
+	section, err := migrationSection(content, DirectionUp)
+	require.NoError(t, err)
+	assert.Equal(t, "\n\nCREATE TABLE t (a INT);", string(section))
+
+	section, err = migrationSection(content, DirectionDown)
+	require.NoError(t, err)
+	assert.Equal(t, "\n\n\n\nDROP TABLE t;", string(section))
+
+	section, err = migrationSection([]byte("-- +migrate up\nCREATE TABLE t (a INT);"), DirectionDown)
+	require.NoError(t, err)
+	assert.Empty(t, section)
+
+	_, err = migrationSection([]byte("-- +migrate down\nDROP TABLE t;"), DirectionUp)
+	assert.EqualError(t, err, "there is no up section")
+
+	_, err = migrationSection([]byte("CREATE TABLE t (a INT);\n-- +migrate up\n"), DirectionUp)
+	assert.EqualError(t, err, "line 1: statement before the first -- +migrate up or -- +migrate down marker")
+
+	_, err = migrationSection([]byte("-- +migrate up\n-- +migrate down\n-- +migrate up\n"), DirectionDown)
+	assert.EqualError(t, err, "line 3: duplicated up section")
+}
+
+func Test_migrationChecksum(t *testing.T) {
+	migration := &Migration{SingleFile: true, Direction: DirectionUp}
+
+	section, err := migrationSection([]byte("-- +migrate down\nDROP TABLE t;\n-- +migrate up\nCREATE TABLE t (a INT);"), DirectionUp)
+	require.NoError(t, err)
+	changed, err := migrationSection([]byte("-- +migrate down\nDROP TABLE t;\nDROP INDEX t_a;\n-- +migrate up\nCREATE TABLE t (a INT);"), DirectionUp)
+	require.NoError(t, err)
+
+	// changes of the down section placed before the up one don't change the up checksum
+	assert.Equal(t, checksum([]byte("CREATE TABLE t (a INT);")), migrationChecksum(migration, section))
+	assert.Equal(t, migrationChecksum(migration, section), migrationChecksum(migration, changed))
+
+	migration.SingleFile = false
+	assert.Equal(t, checksum([]byte("\nCREATE TABLE t (a INT);")), migrationChecksum(migration, []byte("\nCREATE TABLE t (a INT);")))
+}
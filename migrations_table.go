@@ -0,0 +1,239 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// migrationsTableVersion is the current version of the migrations table schema, it is increased by every change of the schema
+// and is stored in the separate table, so the migrations table can be upgraded by newer dbmigrate versions
+const migrationsTableVersion = 7
+
+// migrationsTableUpgrades are the functions upgrading the migrations table schema, i-th one upgrades it from version i+1
+var migrationsTableUpgrades = []func(w *dbWrapper, ctx context.Context) error{
+	(*dbWrapper).addChecksumColumn,
+	(*dbWrapper).addBatchColumn,
+	(*dbWrapper).rebuildMigrationsTable,
+	(*dbWrapper).createHistoryTable,
+	(*dbWrapper).addBaselinedColumn,
+	(*dbWrapper).createDirtyTable,
+}
+
+// dbTimestampFormat is the format of the native timestamp values passed to the database
+const dbTimestampFormat = "2006-01-02 15:04:05"
+
+// migrationsTableQuery returns the query creating the migrations table with the current schema and the given qualified name
+func (w *dbWrapper) migrationsTableQuery(table string) string {
+	return fmt.Sprintf("CREATE TABLE %s (version VARCHAR(14) NOT NULL, applied_at %s NOT NULL, duration_ms INTEGER, batch INTEGER, "+
+		"checksum VARCHAR(64), applied_by VARCHAR(255), host VARCHAR(255), dbmigrate_version VARCHAR(32), baselined INTEGER, PRIMARY KEY(version));",
+		table, w.provider.TimestampType())
+}
+
+// versionTable returns the unqualified name of the table holding the migrations table schema version
+func (w *dbWrapper) versionTable() string {
+	return w.MigrationsTable + "_version"
+}
+
+// migrationsTableSchemaVersion returns the schema version of the migrations table, tables created before the version was stored
+// are recognized by their columns, as well as tables which version is not stored yet, because they are being created by another process
+// or their creation was interrupted
+func (w *dbWrapper) migrationsTableSchemaVersion(ctx context.Context) (int, error) {
+	hasVersionTable, err := w.hasTable(ctx, w.versionTable())
+	if err != nil {
+		return 0, errors.Wrap(err, "can't check if migrations table version table exists")
+	}
+
+	if hasVersionTable {
+		var version int
+		err = w.db.QueryRowContext(ctx, fmt.Sprintf("SELECT version FROM %s", w.qualifiedTable(w.versionTable()))).Scan(&version)
+		if err == nil {
+			return version, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, errors.Wrap(err, "can't get migrations table version")
+		}
+	}
+
+	hasBatch, err := w.hasMigrationsTableColumn(ctx, "batch")
+	if err != nil {
+		return 0, err
+	}
+	if hasBatch {
+		return 3, nil
+	}
+	hasChecksum, err := w.hasMigrationsTableColumn(ctx, "checksum")
+	if err != nil {
+		return 0, err
+	}
+	if hasChecksum {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+// setMigrationsTableSchemaVersion stores the schema version of the migrations table,
+// the old version is replaced in the transaction, so the table never has no or several versions
+func (w *dbWrapper) setMigrationsTableSchemaVersion(ctx context.Context, version int) error {
+	table := w.qualifiedTable(w.versionTable())
+	_, err := w.db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL);", table))
+	if err != nil {
+		return errors.Wrap(err, "can't create migrations table version table")
+	}
+
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can't begin transaction")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", table))
+	if err != nil {
+		return errors.Wrap(err, "can't set migrations table version")
+	}
+	_, err = tx.ExecContext(ctx, w.setPlaceholders(fmt.Sprintf("INSERT INTO %s (version) VALUES (?)", table)), version)
+	if err != nil {
+		return errors.Wrap(err, "can't set migrations table version")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "can't commit migrations table version transaction")
+	}
+	return nil
+}
+
+// upgradeMigrationsTable upgrades the migrations table created by the older dbmigrate version to the current schema,
+// holding the migrations lock, so the table is upgraded only once if several processes connect at the same time
+func (w *dbWrapper) upgradeMigrationsTable(ctx context.Context) error {
+	version, err := w.migrationsTableSchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version >= migrationsTableVersion {
+		return nil
+	}
+
+	err = w.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer w.unlock()
+
+	// the table could have been upgraded by another process while waiting for the lock
+	version, err = w.migrationsTableSchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	for ; version < migrationsTableVersion; version++ {
+		err = migrationsTableUpgrades[version-1](w, ctx)
+		if err != nil {
+			return errors.Wrapf(err, "can't upgrade migrations table from version %d", version)
+		}
+		err = w.setMigrationsTableSchemaVersion(ctx, version+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addChecksumColumn adds checksums of migrations files, version 2 of the schema
+func (w *dbWrapper) addChecksumColumn(ctx context.Context) error {
+	return w.addMigrationsTableColumn(ctx, "checksum", "VARCHAR(64)")
+}
+
+// addBatchColumn adds explicit batch numbers, version 3 of the schema,
+// batches of migrations applied before were defined by their applied at times
+func (w *dbWrapper) addBatchColumn(ctx context.Context) error {
+	err := w.addMigrationsTableColumn(ctx, "batch", "INTEGER")
+	if err != nil {
+		return err
+	}
+	return w.fillBatches(ctx)
+}
+
+// rebuildMigrationsTable recreates the migrations table with native timestamp applied at times
+// and the columns describing how migrations were applied, version 4 of the schema.
+// The type of the applied_at column can't be changed in place in all supported engines, so the data is copied to the new table
+func (w *dbWrapper) rebuildMigrationsTable(ctx context.Context) error {
+	rows, err := w.db.QueryContext(ctx, fmt.Sprintf("SELECT version, applied_at, checksum, batch FROM %s", w.migrationsTable()))
+	if err != nil {
+		return errors.Wrap(err, "can't get applied migrations data")
+	}
+
+	var mds []*migrationData
+	for rows.Next() {
+		var version, appliedAt string
+		var checksum sql.NullString
+		var batch sql.NullInt64
+		err = rows.Scan(&version, &appliedAt, &checksum, &batch)
+		if err != nil {
+			rows.Close()
+			return errors.Wrap(err, "can't scan migrations table's row")
+		}
+
+		// the old table is dropped, so data which can't be copied must stop the upgrade
+		md := &migrationData{checksum: checksum.String, batch: int(batch.Int64)}
+		md.version, err = time.Parse(TimestampFormat, version)
+		if err != nil {
+			rows.Close()
+			return errors.Wrapf(err, "can't parse version %s", version)
+		}
+		md.appliedAt, err = time.Parse(TimestampFormat, appliedAt)
+		if err != nil {
+			rows.Close()
+			return errors.Wrapf(err, "can't parse applied at time %s of migration with version %s", appliedAt, version)
+		}
+		mds = append(mds, md)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return errors.Wrap(err, "can't get applied migrations data")
+	}
+
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "can't begin transaction")
+	}
+	defer tx.Rollback()
+
+	table := w.qualifiedTable(w.MigrationsTable + "_upgrade")
+	_, err = tx.ExecContext(ctx, w.migrationsTableQuery(table))
+	if err != nil {
+		return errors.Wrap(err, "can't create new migrations table")
+	}
+	for _, md := range mds {
+		_, err = tx.ExecContext(ctx, w.setPlaceholders(fmt.Sprintf(
+			"INSERT INTO %s (version, applied_at, batch, checksum) VALUES (?, ?, ?, ?)", table)),
+			md.version.Format(TimestampFormat), md.appliedAt.Format(dbTimestampFormat), md.batch, sql.NullString{String: md.checksum, Valid: md.checksum != ""})
+		if err != nil {
+			return errors.Wrapf(err, "can't copy data of migration with version %s", md.version.Format(TimestampFormat))
+		}
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", w.migrationsTable()))
+	if err != nil {
+		return errors.Wrap(err, "can't drop old migrations table")
+	}
+	// the new name can't be qualified, the table stays in its schema
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s RENAME TO %s", table, w.MigrationsTable))
+	if err != nil {
+		return errors.Wrap(err, "can't rename new migrations table")
+	}
+
+	return tx.Commit()
+}
+
+// addBaselinedColumn adds flags of migrations recorded by Baseline without execution, version 6 of the schema.
+// Tables rebuilt by the version 4 upgrade are created with the current schema, so they already have the column
+func (w *dbWrapper) addBaselinedColumn(ctx context.Context) error {
+	hasBaselined, err := w.hasMigrationsTableColumn(ctx, "baselined")
+	if err != nil || hasBaselined {
+		return err
+	}
+	return w.addMigrationsTableColumn(ctx, "baselined", "INTEGER")
+}
@@ -0,0 +1,70 @@
+package dbmigrate
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_dbWrapper_migrationsTableSchemaVersion(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	w := newDBWrapper(&Settings{Engine: "sqlite", Database: "test.db", MigrationsTable: "migrations", LockTimeout: DefaultLockTimeout}, providers["sqlite"])
+	require.NoError(t, w.open())
+	defer w.close()
+	ctx := context.Background()
+
+	// tables created before the version was stored are recognized by their columns
+	_, err := w.db.Exec("CREATE TABLE migrations (version VARCHAR(14) NOT NULL, applied_at VARCHAR(14) NOT NULL, checksum VARCHAR(64), PRIMARY KEY(version));")
+	require.NoError(t, err)
+	version, err := w.migrationsTableSchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	require.NoError(t, w.addBatchColumn(ctx))
+	version, err = w.migrationsTableSchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+
+	require.NoError(t, w.upgradeMigrationsTable(ctx))
+	version, err = w.migrationsTableSchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, migrationsTableVersion, version)
+	has, err := w.hasTable(ctx, "migrations_upgrade")
+	require.NoError(t, err)
+	assert.False(t, has)
+
+	// the stored version takes precedence and is not changed if the table is up to date
+	require.NoError(t, w.setMigrationsTableSchemaVersion(ctx, migrationsTableVersion+1))
+	require.NoError(t, w.upgradeMigrationsTable(ctx))
+	version, err = w.migrationsTableSchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, migrationsTableVersion+1, version)
+}
+
+func Test_dbWrapper_rebuildMigrationsTable(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	w := newDBWrapper(&Settings{Engine: "sqlite", Database: "test.db", MigrationsTable: "migrations"}, providers["sqlite"])
+	require.NoError(t, w.open())
+	defer w.close()
+	ctx := context.Background()
+
+	_, err := w.db.Exec("CREATE TABLE migrations (version VARCHAR(14) NOT NULL, applied_at VARCHAR(14) NOT NULL, checksum VARCHAR(64), batch INTEGER, PRIMARY KEY(version));")
+	require.NoError(t, err)
+	_, err = w.db.Exec("INSERT INTO migrations (version, applied_at, batch) VALUES ('20180918200453', '2018-09-20 10:00', 1)")
+	require.NoError(t, err)
+
+	// the old table is not dropped if its data can't be copied
+	err = w.rebuildMigrationsTable(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't parse applied at time 2018-09-20 10:00 of migration with version 20180918200453")
+	var appliedAt string
+	require.NoError(t, w.db.QueryRow("SELECT applied_at FROM migrations").Scan(&appliedAt))
+	assert.Equal(t, "2018-09-20 10:00", appliedAt)
+}
@@ -1,10 +1,9 @@
 package dbmigrate
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -22,12 +21,23 @@ type Migrator struct {
 	// Settings used by migrator
 	*Settings
 	// dbWrapper wraps database operations
-	dbWrapper  *dbWrapper
-	projectDir string
+	dbWrapper *dbWrapper
+	// lockDepth is the number of nested Lock calls
+	lockDepth int
+	// user and host are recorded in the migrations table for applied migrations
+	user string
+	host string
 }
 
 // NewMigrator creates new Migrator instance
 func NewMigrator(settings *Settings) (*Migrator, error) {
+	if settings.URL != "" {
+		err := applyURL(settings)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if settings.Engine == "" {
 		return nil, errors.New("database engine not specified")
 	}
@@ -35,53 +45,135 @@ func NewMigrator(settings *Settings) (*Migrator, error) {
 		return nil, errors.New("database name not specified")
 	}
 
-	if settings.MigrationsTable == "" {
-		settings.MigrationsTable = "migrations"
+	m, err := newMigrator(settings)
+	if err != nil {
+		return nil, err
 	}
 
-	m := &Migrator{Settings: settings}
+	err = m.dbWrapper.open()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create database connection")
+	}
 
-	wd, err := os.Getwd()
+	err = m.prepareDB()
 	if err != nil {
-		return nil, errors.Wrap(err, "can't get working directory")
+		m.dbWrapper.close()
+		return nil, err
 	}
+	return m, nil
+}
+
+// NewMigratorWithDB creates new Migrator instance using db, which is the existing connections pool to the database of the engine.
+// Connection settings are ignored, settings can be nil if the defaults are used. Schema can't be set,
+// because search path is set when the connection is opened, so it should be set by the caller.
+// Settings are copied, so they can be reused. Migrator doesn't close db, so it should be closed by the caller after the migrator is closed
+func NewMigratorWithDB(db *sql.DB, engine string, settings *Settings) (*Migrator, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	if settings == nil {
+		settings = &Settings{}
+	}
+	if engine == "" {
+		return nil, errors.New("database engine not specified")
+	}
+	if settings.Schema != "" {
+		return nil, errors.New("schema can't be set for the existing connections pool, set search path of its connections instead")
+	}
+	// defaults are set on the copy, so the caller can reuse settings for several pools
+	s := *settings
+	s.Engine = engine
 
-	m.projectDir, err = FindProjectDir(wd)
+	m, err := newMigrator(&s)
 	if err != nil {
 		return nil, err
 	}
+	m.dbWrapper.db = db
 
-	p, ok := providers[settings.Engine]
+	err = m.prepareDB()
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// newMigrator checks settings, sets defaults and creates Migrator instance without database connection
+func newMigrator(settings *Settings) (*Migrator, error) {
+	if settings.MigrationsTable == "" {
+		settings.MigrationsTable = "migrations"
+	}
+
+	if settings.LockTimeout == 0 {
+		settings.LockTimeout = DefaultLockTimeout
+	}
+
+	if settings.MigrationsSource == nil {
+		migrationsPath, err := settings.migrationsPath()
+		if err != nil {
+			return nil, err
+		}
+		settings.MigrationsSource = DirSource(migrationsPath)
+	}
+
+	p, ok := providerByName(settings.Engine)
 	if !ok {
 		return nil, errors.Errorf("unknown database engine %s", settings.Engine)
 	}
-
-	m.dbWrapper = newDBWrapper(settings, p)
-	err = m.dbWrapper.open()
+	if settings.Schema != "" && settings.Engine != "postgres" {
+		return nil, errors.Errorf("schema is supported only by postgres, not by %s", settings.Engine)
+	}
+	err := checkTLSSettings(settings)
 	if err != nil {
-		return nil, errors.Wrap(err, "can't create database connection")
+		return nil, err
+	}
+
+	return &Migrator{Settings: settings, dbWrapper: newDBWrapper(settings, p), user: currentUser(), host: currentHost()}, nil
+}
+
+// prepareDB creates the schema and the migrations table if they don't exist yet,
+// or upgrades the migrations table created by the older dbmigrate version
+func (m *Migrator) prepareDB() error {
+	if m.Schema != "" {
+		err := m.dbWrapper.createSchema(context.Background())
+		if err != nil {
+			return err
+		}
 	}
 
-	// create migrations table if it is not exists yet
-	migrationsTableExists, err := m.dbWrapper.hasMigrationsTable()
+	migrationsTableExists, err := m.dbWrapper.hasMigrationsTable(context.Background())
 	if err != nil {
-		return nil, errors.Wrap(err, "can't check if migrations table exists")
+		return errors.Wrap(err, "can't check if migrations table exists")
 	}
 	if !migrationsTableExists {
-		err = m.dbWrapper.createMigrationsTable()
+		err = m.dbWrapper.createMigrationsTable(context.Background())
+		if err != nil {
+			return errors.Wrap(err, "can't create migrations table")
+		}
+	} else {
+		err = m.dbWrapper.upgradeMigrationsTable(context.Background())
 		if err != nil {
-			return nil, errors.Wrap(err, "can't create migrations table")
+			return errors.Wrap(err, "can't upgrade migrations table")
 		}
 	}
-
-	return m, nil
+	return nil
 }
 
 // GenerateMigration generates up and down migrations with given name for given engine
 func (m *Migrator) GenerateMigration(descr string, engines ...string) ([]string, error) {
+	return m.generateMigration(descr, false, engines...)
+}
+
+// GenerateSingleFileMigration generates migration with given name for given engine,
+// holding both up and down sections in one file
+func (m *Migrator) GenerateSingleFileMigration(descr string, engines ...string) ([]string, error) {
+	return m.generateMigration(descr, true, engines...)
+}
+
+// generateMigration creates either up and down or single migration files for each of engines
+func (m *Migrator) generateMigration(descr string, singleFile bool, engines ...string) ([]string, error) {
 	if engines != nil {
 		for _, engine := range engines {
-			if _, ok := providers[engine]; !ok {
+			if _, ok := providerByName(engine); !ok {
 				return nil, errors.Errorf("database engine %s is not exists/supported", engine)
 			}
 		}
@@ -91,26 +183,31 @@ func (m *Migrator) GenerateMigration(descr string, engines ...string) ([]string,
 		engines = []string{""}
 	}
 
+	name := regexp.MustCompile(`\s+`).ReplaceAllString(strings.TrimSpace(strings.ToLower(descr)), "_")
+
 	var fpaths []string
 	for _, engine := range engines {
 		ts := time.Now().UTC()
-		re := regexp.MustCompile(`\s+`)
 
-		for _, direction := range []string{"up", "down"} {
-			parts := []string{ts.Format(TimestampFormat), re.ReplaceAllString(strings.TrimSpace(strings.ToLower(descr)), "_"), direction}
-			if engine != "" {
-				parts = append(parts, engine)
-			}
-			parts = append(parts, "sql")
+		migrations := []*Migration{
+			{Version: ts, Name: name, Direction: DirectionUp, Engine: engine},
+			{Version: ts, Name: name, Direction: DirectionDown, Engine: engine},
+		}
+		content := ""
+		if singleFile {
+			migrations = []*Migration{{Version: ts, Name: name, Engine: engine, SingleFile: true}}
+			content = upSectionMarker + "\n\n" + downSectionMarker + "\n"
+		}
 
-			fname := strings.Join(parts, ".")
-			fpath := filepath.Join(MigrationsDir, fname)
+		for _, migration := range migrations {
+			fname := migration.FileName()
+			fpath := filepath.Join(m.generatedMigrationsPath(), fname)
 
 			if FileExists(fpath) {
 				return nil, errors.Errorf("migration file %s already exists", fname)
 			}
 
-			_, err := os.Create(fpath)
+			err := ioutil.WriteFile(fpath, []byte(content), 0644)
 			if err != nil {
 				return nil, errors.Wrapf(err, "can't create migration file %s", fname)
 			}
@@ -122,23 +219,59 @@ func (m *Migrator) GenerateMigration(descr string, engines ...string) ([]string,
 	return fpaths, nil
 }
 
+// generatedMigrationsPath returns the dir to create generated migrations files in
+func (m *Migrator) generatedMigrationsPath() string {
+	if m.MigrationsPath != "" {
+		return m.MigrationsPath
+	}
+	return MigrationsDir
+}
+
 // Close frees resources acquired by migrator
 func (m *Migrator) Close() error {
 	err := m.dbWrapper.close()
 	if err != nil {
 		return errors.Wrap(err, "error closing migrator")
 	}
+	m.lockDepth = 0
+
+	return nil
+}
+
+// Lock acquires the database-level lock which prevents other processes from migrating the database at the same time.
+// Migrate and rollback operations take the lock by themselves, so it should be used only to hold it across several operations.
+// Lock calls can be nested, the lock is released when Unlock is called the same number of times
+func (m *Migrator) Lock() error {
+	return m.LockContext(context.Background())
+}
 
-	if m.MigrationsCh != nil {
-		close(m.MigrationsCh)
-		m.MigrationsCh = nil
+// LockContext is the same as Lock, but stops waiting for the lock when ctx is cancelled
+func (m *Migrator) LockContext(ctx context.Context) error {
+	if m.lockDepth == 0 {
+		err := m.dbWrapper.lock(ctx)
+		if err != nil {
+			return errors.Wrap(err, "can't acquire migrations lock")
+		}
 	}
+	m.lockDepth++
+	return nil
+}
 
-	if m.ErrorsCh != nil {
-		close(m.ErrorsCh)
-		m.ErrorsCh = nil
+// Unlock releases the lock acquired by Lock
+func (m *Migrator) Unlock() error {
+	if m.lockDepth == 0 {
+		return errors.New("migrations lock is not held")
 	}
 
+	m.lockDepth--
+	if m.lockDepth > 0 {
+		return nil
+	}
+
+	err := m.dbWrapper.unlock()
+	if err != nil {
+		return errors.Wrap(err, "can't release migrations lock")
+	}
 	return nil
 }
 
@@ -149,24 +282,102 @@ func (m *Migrator) Migrate() (int, error) {
 
 // MigrateSteps applies the number of migrations specified by the steps variable, returning number of applied migrations
 func (m *Migrator) MigrateSteps(steps int) (int, error) {
-	migrations, err := m.unappliedMigrations()
+	return m.MigrateContext(context.Background(), steps)
+}
+
+// MigrateContext is the same as MigrateSteps, but it can be cancelled using ctx,
+// in which case the migration being executed is interrupted and rolled back (if the database engine supports DDL transactions)
+func (m *Migrator) MigrateContext(ctx context.Context, steps int) (int, error) {
+	err := m.LockContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.Unlock()
+
+	migrations, err := m.migrationsToApply(ctx, steps)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.applyMigrations(ctx, migrations)
+}
+
+// MigrateTo applies all unapplied migrations up to and including the one with the given version
+func (m *Migrator) MigrateTo(version time.Time) (int, error) {
+	return m.MigrateToContext(context.Background(), version)
+}
+
+// MigrateToContext is the same as MigrateTo, but it can be cancelled using ctx
+func (m *Migrator) MigrateToContext(ctx context.Context, version time.Time) (int, error) {
+	err := m.LockContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.Unlock()
+
+	migrations, err := m.migrationsToApplyTo(ctx, version)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.applyMigrations(ctx, migrations)
+}
+
+// migrationsToApply returns unapplied migrations, limited by the steps variable
+func (m *Migrator) migrationsToApply(ctx context.Context, steps int) ([]*Migration, error) {
+	migrations, err := m.unappliedMigrations(ctx)
 	if err != nil {
-		return 0, errors.Wrap(err, "can't find migrations")
+		return nil, errors.Wrap(err, "can't find migrations")
 	}
 
 	if steps == AllSteps || steps > len(migrations) {
 		steps = len(migrations)
 	}
 
+	return migrations[:steps], nil
+}
+
+// migrationsToApplyTo returns unapplied migrations up to and including the one with the given version
+func (m *Migrator) migrationsToApplyTo(ctx context.Context, version time.Time) ([]*Migration, error) {
+	_, err := m.getMigration(version, DirectionUp)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't find target migration")
+	}
+
+	unappliedMigrations, err := m.unappliedMigrations(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't find migrations")
+	}
+
+	var migrations []*Migration
+	for _, migration := range unappliedMigrations {
+		if !migration.Version.After(version) {
+			migrations = append(migrations, migration)
+		}
+	}
+
+	return migrations, nil
+}
+
+// applyMigrations runs given up migrations as one batch
+func (m *Migrator) applyMigrations(ctx context.Context, migrations []*Migration) (int, error) {
+	batch, err := m.dbWrapper.lastBatch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	batch++
+
 	appliedAt := time.Now().UTC()
-	for i, migration := range migrations[:steps] {
+	for i, migration := range migrations {
 		migration.AppliedAt = appliedAt
-		err = m.run(migration)
+		migration.Batch = batch
+		migration.AppliedBy, migration.Host = m.user, m.host
+		err := m.run(ctx, migration)
 		if err != nil {
 			return i, errors.Wrapf(err, "can't execute migration %s", migration.FileName())
 		}
 	}
-	return len(migrations[:steps]), nil
+	return len(migrations), nil
 }
 
 // Rollback rolls back last migration operation
@@ -176,15 +387,82 @@ func (m *Migrator) Rollback() (int, error) {
 
 // RollbackSteps rolls back the number of migrations specified by the steps variable
 func (m *Migrator) RollbackSteps(steps int) (int, error) {
-	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData("applied_at DESC, version DESC")
+	return m.RollbackContext(context.Background(), steps)
+}
+
+// RollbackContext is the same as RollbackSteps, but it can be cancelled using ctx
+func (m *Migrator) RollbackContext(ctx context.Context, steps int) (int, error) {
+	err := m.LockContext(ctx)
 	if err != nil {
-		return 0, errors.Wrap(err, "can't rollback")
+		return 0, err
+	}
+	defer m.Unlock()
+
+	mds, err := m.migrationsToRollback(ctx, steps)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.rollbackMigrations(ctx, mds)
+}
+
+// RollbackTo rolls back all migrations applied after the one with the given version, which stays applied
+func (m *Migrator) RollbackTo(version time.Time) (int, error) {
+	return m.RollbackToContext(context.Background(), version)
+}
+
+// RollbackToContext is the same as RollbackTo, but it can be cancelled using ctx
+func (m *Migrator) RollbackToContext(ctx context.Context, version time.Time) (int, error) {
+	err := m.LockContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.Unlock()
+
+	mds, err := m.migrationsToRollbackTo(ctx, version)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.rollbackMigrations(ctx, mds)
+}
+
+// RollbackBatch rolls back migrations applied during the migrate operation with the given batch number,
+// which is not necessarily the last one
+func (m *Migrator) RollbackBatch(batch int) (int, error) {
+	return m.RollbackBatchContext(context.Background(), batch)
+}
+
+// RollbackBatchContext is the same as RollbackBatch, but it can be cancelled using ctx
+func (m *Migrator) RollbackBatchContext(ctx context.Context, batch int) (int, error) {
+	err := m.LockContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.Unlock()
+
+	mds, err := m.migrationsToRollbackBatch(ctx, batch)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.rollbackMigrations(ctx, mds)
+}
+
+// migrationsToRollback returns data of applied migrations to be rolled back, limited by the steps variable,
+// 0 steps means the last migration operation
+func (m *Migrator) migrationsToRollback(ctx context.Context, steps int) ([]*migrationData, error) {
+	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData(ctx, "batch DESC, version DESC")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't rollback")
 	}
 
 	if steps == 0 {
-		steps, err = m.dbWrapper.countMigrationsInLastBatch()
-		if err != nil {
-			return 0, errors.Wrap(err, "can't get migrations in last batch")
+		for _, migrationData := range appliedMigrationsData {
+			if migrationData.batch != appliedMigrationsData[0].batch {
+				break
+			}
+			steps++
 		}
 	}
 
@@ -192,86 +470,497 @@ func (m *Migrator) RollbackSteps(steps int) (int, error) {
 		steps = len(appliedMigrationsData)
 	}
 
-	// get migrations list
+	return appliedMigrationsData[:steps], nil
+}
+
+// migrationsToRollbackTo returns data of migrations applied after the one with the given version
+func (m *Migrator) migrationsToRollbackTo(ctx context.Context, version time.Time) ([]*migrationData, error) {
+	_, err := m.getMigration(version, DirectionUp)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't find target migration")
+	}
+
+	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData(ctx, "batch DESC, version DESC")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't rollback")
+	}
+
+	var mds []*migrationData
+	for _, migrationData := range appliedMigrationsData {
+		if migrationData.version.After(version) {
+			mds = append(mds, migrationData)
+		}
+	}
+
+	return mds, nil
+}
+
+// migrationsToRollbackBatch returns data of migrations applied during the migrate operation with the given batch number
+func (m *Migrator) migrationsToRollbackBatch(ctx context.Context, batch int) ([]*migrationData, error) {
+	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData(ctx, "version DESC")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't rollback")
+	}
+
+	var mds []*migrationData
+	for _, migrationData := range appliedMigrationsData {
+		if migrationData.batch == batch {
+			mds = append(mds, migrationData)
+		}
+	}
+	if len(mds) == 0 {
+		return nil, errors.Errorf("batch %d does not exist", batch)
+	}
+
+	return mds, nil
+}
+
+// rollbackMigrations finds and runs down migrations for the given applied migrations data
+func (m *Migrator) rollbackMigrations(ctx context.Context, appliedMigrationsData []*migrationData) (int, error) {
+	migrations, missingErrs, err := m.downMigrations(appliedMigrationsData)
+	if err != nil {
+		return 0, err
+	}
+	for _, err := range missingErrs {
+		m.notify(&Event{Type: EventWarning, Err: err})
+	}
+
+	for i, migration := range migrations {
+		err := m.run(ctx, migration)
+		if err != nil {
+			return i, errors.Wrapf(err, "can't execute migration %s", migration.FileName())
+		}
+	}
+	return len(migrations), nil
+}
+
+// downMigrations finds down migrations for the given applied migrations data.
+// If missing down migrations are allowed, errors about them are returned as the second value
+func (m *Migrator) downMigrations(appliedMigrationsData []*migrationData) ([]*Migration, []error, error) {
 	var migrations []*Migration
-	for _, migrationData := range appliedMigrationsData[:steps] {
+	var missingErrs []error
+	for _, migrationData := range appliedMigrationsData {
 		migration, err := m.getMigration(migrationData.version, DirectionDown)
 		if err == nil {
+			migration.Batch = migrationData.batch
 			migrations = append(migrations, migration)
-		} else {
-			err = errors.Wrapf(err, "can't get migration for version %s", migrationData.version.Format(PrintTimestampFormat))
-			if !m.AllowMissingDowns {
-				return 0, err
+			continue
+		}
+		err = errors.Wrapf(err, "can't get migration for version %s", migrationData.version.Format(PrintTimestampFormat))
+		if !m.AllowMissingDowns {
+			return nil, nil, err
+		}
+		missingErrs = append(missingErrs, err)
+	}
+	return migrations, missingErrs, nil
+}
+
+// Plan returns what migrate (for DirectionUp) or rollback (for DirectionDown) operation with the given steps would execute,
+// without changing the database
+func (m *Migrator) Plan(direction Direction, steps int) (*Plan, error) {
+	return m.PlanContext(context.Background(), direction, steps)
+}
+
+// PlanContext is the same as Plan, but it can be cancelled using ctx
+func (m *Migrator) PlanContext(ctx context.Context, direction Direction, steps int) (*Plan, error) {
+	switch direction {
+	case DirectionUp:
+		migrations, err := m.migrationsToApply(ctx, steps)
+		if err != nil {
+			return nil, err
+		}
+		return m.planApply(ctx, migrations)
+	case DirectionDown:
+		mds, err := m.migrationsToRollback(ctx, steps)
+		if err != nil {
+			return nil, err
+		}
+		return m.planRollback(mds)
+	}
+	return nil, errors.New("can't plan, incorrect direction")
+}
+
+// PlanTo returns what MigrateTo (for DirectionUp) or RollbackTo (for DirectionDown) with the given version would execute,
+// without changing the database
+func (m *Migrator) PlanTo(direction Direction, version time.Time) (*Plan, error) {
+	return m.PlanToContext(context.Background(), direction, version)
+}
+
+// PlanToContext is the same as PlanTo, but it can be cancelled using ctx
+func (m *Migrator) PlanToContext(ctx context.Context, direction Direction, version time.Time) (*Plan, error) {
+	switch direction {
+	case DirectionUp:
+		migrations, err := m.migrationsToApplyTo(ctx, version)
+		if err != nil {
+			return nil, err
+		}
+		return m.planApply(ctx, migrations)
+	case DirectionDown:
+		mds, err := m.migrationsToRollbackTo(ctx, version)
+		if err != nil {
+			return nil, err
+		}
+		return m.planRollback(mds)
+	}
+	return nil, errors.New("can't plan, incorrect direction")
+}
+
+// PlanBatch returns what RollbackBatch with the given batch number would execute, without changing the database
+func (m *Migrator) PlanBatch(batch int) (*Plan, error) {
+	return m.PlanBatchContext(context.Background(), batch)
+}
+
+// PlanBatchContext is the same as PlanBatch, but it can be cancelled using ctx
+func (m *Migrator) PlanBatchContext(ctx context.Context, batch int) (*Plan, error) {
+	mds, err := m.migrationsToRollbackBatch(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+	return m.planRollback(mds)
+}
+
+// ReversePlan returns the plan which reverts the migrations of the given one,
+// e.g. the rollback plan reversed gives the second half of the reapply operation
+func (m *Migrator) ReversePlan(plan *Plan) (*Plan, error) {
+	if plan.Direction == DirectionUp {
+		mds := make([]*migrationData, len(plan.Steps))
+		for i, step := range plan.Steps {
+			mds[len(mds)-1-i] = &migrationData{version: step.Migration.Version}
+		}
+		return m.planRollback(mds)
+	}
+
+	migrations := make([]*Migration, len(plan.Steps))
+	rolledBack := make(map[time.Time]bool)
+	for i, step := range plan.Steps {
+		migration, err := m.getMigration(step.Migration.Version, DirectionUp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't get migration for version %s", step.Migration.Version.Format(PrintTimestampFormat))
+		}
+		migrations[len(migrations)-1-i] = migration
+		rolledBack[migration.Version] = true
+	}
+
+	// migrations are applied again after the rollback, so the batch follows the last one of migrations which stay applied
+	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData(context.Background(), "version ASC")
+	if err != nil {
+		return nil, err
+	}
+	batch := 0
+	for _, migrationData := range appliedMigrationsData {
+		if !rolledBack[migrationData.version] && migrationData.batch > batch {
+			batch = migrationData.batch
+		}
+	}
+
+	return m.planMigrations(DirectionUp, migrations, batch+1)
+}
+
+// planApply plans given up migrations as the next batch
+func (m *Migrator) planApply(ctx context.Context, migrations []*Migration) (*Plan, error) {
+	batch, err := m.dbWrapper.lastBatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.planMigrations(DirectionUp, migrations, batch+1)
+}
+
+// planRollback finds down migrations for the given applied migrations data and plans them
+func (m *Migrator) planRollback(appliedMigrationsData []*migrationData) (*Plan, error) {
+	migrations, _, err := m.downMigrations(appliedMigrationsData)
+	if err != nil {
+		return nil, err
+	}
+	return m.planMigrations(DirectionDown, migrations, 0)
+}
+
+// planMigrations splits given migrations into statements the same way run does, but doesn't execute them,
+// batch is the number up migrations would be applied with
+func (m *Migrator) planMigrations(direction Direction, migrations []*Migration, batch int) (*Plan, error) {
+	plan := &Plan{Direction: direction}
+	appliedAt := time.Now().UTC()
+
+	for _, migration := range migrations {
+		if migration.Direction == DirectionUp {
+			migration.AppliedAt = appliedAt
+			migration.Batch = batch
+			migration.AppliedBy, migration.Host = m.user, m.host
+		}
+
+		// Go migrations are executed inside transaction, only the migrations table statement is known for them
+		if migration.Go {
+			plan.Steps = append(plan.Steps, &PlanStep{
+				Migration:     migration,
+				Transactional: true,
+				Statements:    m.recordStatements(migration, ""),
+			})
+			continue
+		}
+
+		query, err := m.readMigration(migration)
+		if err != nil {
+			return nil, err
+		}
+
+		step := &PlanStep{Migration: migration, Transactional: !hasDirective(string(query), noTransactionDirective)}
+		plan.Steps = append(plan.Steps, step)
+
+		if strings.TrimSpace(string(query)) == "" {
+			if migration.Direction == DirectionUp || !m.AllowMissingDowns {
+				return nil, errors.Errorf("can't plan migration %s: empty query", migration.FileName())
 			}
-			if m.ErrorsCh != nil {
-				m.ErrorsCh <- err
+			continue
+		}
+
+		statements, err := m.dbWrapper.provider.SplitStatements(string(query))
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't split migration %s into statements", migration.FileName())
+		}
+		for _, st := range statements {
+			step.Statements = append(step.Statements, st.Query)
+		}
+
+		step.Statements = append(step.Statements, m.recordStatements(migration, migrationChecksum(migration, query))...)
+	}
+
+	return plan, nil
+}
+
+// recordStatements returns the statements which insert/delete migration data and append the history entry,
+// rendered to be shown in plan
+func (m *Migrator) recordStatements(migration *Migration, checksum string) []string {
+	query, args := m.dbWrapper.insertMigrationDataQuery(m.migrationData(migration, checksum))
+	if migration.Direction == DirectionDown {
+		query, args = m.dbWrapper.deleteMigrationVersionQuery(migration.Version)
+	}
+	historyQuery, historyArgs := m.dbWrapper.insertHistoryEntryQuery(m.historyEntry(migration, 0, nil))
+	return []string{renderQuery(query, args...), renderQuery(historyQuery, historyArgs...)}
+}
+
+// ResolveVersion returns the version of the migration specified either by the version in TimestampFormat or by the name,
+// returning an error if there is no such migration in the migrations dir
+func (m *Migrator) ResolveVersion(s string) (time.Time, error) {
+	migrations, err := m.findMigrations(DirectionUp)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "can't get migrations")
+	}
+
+	if version, err := time.Parse(TimestampFormat, s); err == nil && len(s) == len(TimestampFormat) {
+		for _, migration := range migrations {
+			if migration.Version.Equal(version) {
+				return version, nil
 			}
 		}
+		return time.Time{}, errors.Errorf("migration with version %s does not exist in %s", s, MigrationsDir)
 	}
 
-	// and run them
-	for i, migration := range migrations {
-		err = m.run(migration)
-		if err != nil {
-			return i, errors.Wrapf(err, "can't execute migration %s", migration.FileName())
+	// name can be given as it is used in generate command, e.g. "Create posts"
+	name := regexp.MustCompile(`\s+`).ReplaceAllString(strings.TrimSpace(strings.ToLower(s)), "_")
+	var found []*Migration
+	for _, migration := range migrations {
+		if migration.Name == name {
+			found = append(found, migration)
 		}
 	}
-	return len(migrations), nil
+	if len(found) == 0 {
+		return time.Time{}, errors.Errorf("migration with name %s does not exist in %s", name, MigrationsDir)
+	}
+	if len(found) > 1 {
+		return time.Time{}, errors.Errorf("there are %d migrations with name %s, use version instead", len(found), name)
+	}
+	return found[0].Version, nil
+}
+
+// run executes given migration, notifying the observer
+func (m *Migrator) run(ctx context.Context, migration *Migration) error {
+	err := m.checkDirty(ctx)
+	if err != nil {
+		return err
+	}
+
+	return m.observe(migration, func() (bool, error) {
+		return m.execute(ctx, migration)
+	})
 }
 
-// run executes given migration
-func (m *Migrator) run(migration *Migration) error {
-	fpath := filepath.Join(m.projectDir, MigrationsDir, migration.FileName())
+// observe calls execute, notifying the observer about the migration execution
+// and appending the history entry if it fails, successful executions are recorded by execute
+func (m *Migrator) observe(migration *Migration, execute func() (skipped bool, err error)) error {
+	m.notify(&Event{Type: EventMigrationStarted, Migration: migration})
+
+	start := time.Now()
+	skipped, err := execute()
+	duration := time.Since(start)
+	if err != nil {
+		m.notify(&Event{Type: EventMigrationFailed, Migration: migration, Duration: duration, Err: err})
+		// the history entry is added even if the operation was cancelled
+		historyErr := m.dbWrapper.insertHistoryEntry(context.Background(), m.historyEntry(migration, duration, err), nil)
+		if historyErr != nil {
+			m.notify(&Event{Type: EventWarning, Migration: migration, Err: historyErr})
+		}
+		return err
+	}
+
+	if !skipped {
+		m.notify(&Event{Type: EventMigrationFinished, Migration: migration, Duration: duration})
+	}
+	return nil
+}
+
+// execute executes the migration, recording it in the migrations and history tables if it succeeds,
+// skipped is true if the migration is empty down migration, which is allowed to be skipped
+func (m *Migrator) execute(ctx context.Context, migration *Migration) (skipped bool, err error) {
+	if migration.Go {
+		err := m.dbWrapper.execMigrationFunc(ctx, goMigrationFunc(migration), m.recordFunc(ctx, migration, ""))
+		if err != nil {
+			return false, errors.Wrapf(err, "can't exec Go function for migration %s", migration.FileName())
+		}
+		return false, nil
+	}
 
-	query, err := ioutil.ReadFile(fpath)
+	query, err := m.readMigration(migration)
 	if err != nil {
-		return errors.Wrapf(err, "can't read migration %s", migration.FileName())
+		return false, err
 	}
 
 	if strings.TrimSpace(string(query)) == "" {
 		// optionally allow empty down migrations, notifying about it
 		if migration.Direction == DirectionUp || (migration.Direction == DirectionDown && !m.AllowMissingDowns) {
-			return errors.New("empty query")
+			return false, errors.New("empty query")
 		}
-		if m.ErrorsCh != nil {
-			m.ErrorsCh <- errors.New("empty query")
-		}
-		return nil
+		m.notify(&Event{Type: EventMigrationSkipped, Migration: migration, Err: errors.New("empty query")})
+		return true, nil
 	}
 
-	// insert/delete migration data from the database after executing migration
-	afterFunc := func(tx *sql.Tx) error {
-		err = m.dbWrapper.insertMigrationData(migration.Version, migration.AppliedAt, tx)
+	err = m.executeQuery(ctx, migration, query, nil)
+	if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// executeQuery executes statements of the migration query, recording the migration if all of them succeed.
+// dirty is the state of the partially executed migration if it is resumed, nil otherwise. Statements of migrations
+// without transaction can't be rolled back, so they are tracked in the dirty state, as well as statements of migrations
+// with transaction on engines which commit DDL implicitly, ending the transaction, so all statements following the first DDL one are committed
+func (m *Migrator) executeQuery(ctx context.Context, migration *Migration, query []byte, dirty *DirtyState) error {
+	useTx := !hasDirective(string(query), noTransactionDirective)
+	tracked := !useTx || !m.dbWrapper.transactionalDDL()
+	if dirty == nil && tracked {
+		dirty = &DirtyState{Version: migration.Version, Direction: migration.Direction, Batch: migration.Batch}
+		err := m.dbWrapper.insertDirtyState(dirty)
 		if err != nil {
-			return errors.Wrapf(err, "can't insert version for migration %s", migration.FileName())
+			return err
 		}
+	}
+
+	executed := 0
+	afterFunc := m.recordFunc(ctx, migration, migrationChecksum(migration, query))
+	if dirty != nil {
+		executed = dirty.ExecutedStatements
+		recordFunc := afterFunc
+		afterFunc = func(executor executor) error {
+			err := m.dbWrapper.clearDirtyState(ctx, executor)
+			if err != nil {
+				return err
+			}
+			return recordFunc(executor)
+		}
+	}
+
+	n := executed
+	// statements executed inside transaction are rolled back if the migration fails before the first DDL one
+	committed := !useTx || executed > 0
+	statementFunc := func(st *Statement, duration time.Duration, rowsAffected int64) error {
+		n++
+		committed = committed || isDDL(st.Query)
+		if dirty != nil && tracked && committed {
+			// the migration is stopped if executed statements can't be tracked, otherwise it could be resumed from the wrong one
+			dirty.ExecutedStatements = n
+			err := m.dbWrapper.updateDirtyState(dirty)
+			if err != nil {
+				return err
+			}
+		}
+		if m.Logger != nil {
+			m.Logger.LogStatement(migration, st, duration, rowsAffected)
+		}
+		m.notify(&Event{Type: EventStatementExecuted, Migration: migration, Statement: st, Duration: duration, RowsAffected: rowsAffected})
 		return nil
 	}
+	err := m.dbWrapper.execMigrationQueries(ctx, string(query), executed, useTx, statementFunc, afterFunc)
+	if err != nil {
+		// the database is not changed if no statements have been executed
+		if dirty != nil && dirty.ExecutedStatements == 0 {
+			clearErr := m.dbWrapper.clearDirtyState(context.Background(), nil)
+			if clearErr != nil {
+				m.notify(&Event{Type: EventWarning, Migration: migration, Err: clearErr})
+			}
+		}
+		return errors.Wrapf(err, "can't exec query for migration %s", migration.FileName())
+	}
+	return nil
+}
+
+// recordFunc returns the function which inserts/deletes migration data from the database after executing migration
+// and appends the history entry
+func (m *Migrator) recordFunc(ctx context.Context, migration *Migration, checksum string) func(executor executor) error {
+	// the function is called right after the migration statements are executed, so the time since now is its duration
+	start := time.Now()
+
 	if migration.Direction == DirectionDown {
-		afterFunc = func(tx *sql.Tx) error {
-			err := m.dbWrapper.deleteMigrationVersion(migration.Version, tx)
+		return func(executor executor) error {
+			err := m.dbWrapper.deleteMigrationVersion(ctx, migration.Version, executor)
 			if err != nil {
 				return errors.Wrapf(err, "can't delete timestamp %s from db", migration.Version.Format(PrintTimestampFormat))
 			}
-			return nil
+			return m.dbWrapper.insertHistoryEntry(ctx, m.historyEntry(migration, time.Since(start), nil), executor)
 		}
 	}
 
-	err = m.dbWrapper.execMigrationQueries(string(query), afterFunc)
-	if err != nil {
-		return errors.Wrapf(err, "can't exec query for migration %s", migration.FileName())
+	return func(executor executor) error {
+		migration.Duration = time.Since(start)
+		err := m.dbWrapper.insertMigrationData(ctx, m.migrationData(migration, checksum), executor)
+		if err != nil {
+			return errors.Wrapf(err, "can't insert version for migration %s", migration.FileName())
+		}
+		return m.dbWrapper.insertHistoryEntry(ctx, m.historyEntry(migration, migration.Duration, nil), executor)
 	}
+}
 
-	if m.MigrationsCh != nil {
-		m.MigrationsCh <- migration
+// migrationData returns the data recorded in the migrations table for the applied migration
+func (m *Migrator) migrationData(migration *Migration, checksum string) *migrationData {
+	return &migrationData{
+		version: migration.Version, appliedAt: migration.AppliedAt, duration: migration.Duration, batch: migration.Batch,
+		checksum: checksum, appliedBy: migration.AppliedBy, host: migration.Host, dbmigrateVersion: Version,
+		baselined: migration.Baselined,
 	}
+}
 
-	return nil
+// readMigration reads the migration file contents, for single-file migrations only the section of its direction is returned
+func (m *Migrator) readMigration(migration *Migration) ([]byte, error) {
+	query, err := m.MigrationsSource.ReadFile(migration.FileName())
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read migration %s", migration.FileName())
+	}
+
+	if migration.SingleFile {
+		query, err = migrationSection(query, migration.Direction)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read %s section of migration %s", migration.Direction, migration.FileName())
+		}
+	}
+	return query, nil
 }
 
 // LatestVersionMigration returns the migration that has the most recent version (which is not necessarily the last applied one)
 func (m *Migrator) LatestVersionMigration() (*Migration, error) {
-	ts, err := m.dbWrapper.latestMigrationVersion()
+	return m.LatestVersionMigrationContext(context.Background())
+}
+
+// LatestVersionMigrationContext is the same as LatestVersionMigration, but it can be cancelled using ctx
+func (m *Migrator) LatestVersionMigrationContext(ctx context.Context) (*Migration, error) {
+	ts, err := m.dbWrapper.latestMigrationVersion(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "can't get latest migration")
 	}
@@ -290,7 +979,12 @@ func (m *Migrator) LatestVersionMigration() (*Migration, error) {
 
 // LastAppliedMigration returns the migration which was applied last
 func (m *Migrator) LastAppliedMigration() (*Migration, error) {
-	ts, err := m.dbWrapper.lastAppliedMigrationVersion()
+	return m.LastAppliedMigrationContext(context.Background())
+}
+
+// LastAppliedMigrationContext is the same as LastAppliedMigration, but it can be cancelled using ctx
+func (m *Migrator) LastAppliedMigrationContext(ctx context.Context) (*Migration, error) {
+	ts, err := m.dbWrapper.lastAppliedMigrationVersion(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "can't get last applied migration")
 	}
@@ -310,12 +1004,17 @@ func (m *Migrator) LastAppliedMigration() (*Migration, error) {
 // Status returns applied a timestamp for each migration or nil if it is not set
 // along with the migration's name and version
 func (m *Migrator) Status() ([]*Migration, error) {
+	return m.StatusContext(context.Background())
+}
+
+// StatusContext is the same as Status, but it can be cancelled using ctx
+func (m *Migrator) StatusContext(ctx context.Context) ([]*Migration, error) {
 	foundMigrations, err := m.findMigrations(DirectionUp)
 	if err != nil {
 		return nil, errors.Wrap(err, "can't get migrations")
 	}
 
-	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData("version ASC")
+	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData(ctx, "version ASC")
 	if err != nil {
 		return nil, err
 	}
@@ -324,6 +1023,10 @@ func (m *Migrator) Status() ([]*Migration, error) {
 		for _, migrationData := range appliedMigrationsData {
 			if m.Version == migrationData.version {
 				m.AppliedAt = migrationData.appliedAt
+				m.Batch = migrationData.batch
+				m.Duration = migrationData.duration
+				m.AppliedBy, m.Host = migrationData.appliedBy, migrationData.host
+				m.Baselined = migrationData.baselined
 				break
 			}
 		}
@@ -332,43 +1035,96 @@ func (m *Migrator) Status() ([]*Migration, error) {
 	return foundMigrations, nil
 }
 
-// findMigrations finds all valid migrations in the dbmigrations dir
-func (m *Migrator) findMigrations(direction Direction) ([]*Migration, error) {
-	var migrations []*Migration
-	migrationsDirPath := filepath.Join(m.projectDir, MigrationsDir)
+// Verify compares applied migrations with the migrations files, returning the differences
+func (m *Migrator) Verify() (*Verification, error) {
+	return m.VerifyContext(context.Background())
+}
 
-	err := filepath.Walk(migrationsDirPath, func(mpath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
+// VerifyContext is the same as Verify, but it can be cancelled using ctx
+func (m *Migrator) VerifyContext(ctx context.Context) (*Verification, error) {
+	foundMigrations, err := m.findMigrations(DirectionUp)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get migrations")
+	}
+
+	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData(ctx, "version ASC")
+	if err != nil {
+		return nil, err
+	}
+
+	foundMigrationsMap := make(map[string]*Migration)
+	for _, migration := range foundMigrations {
+		foundMigrationsMap[migration.Version.Format(TimestampFormat)] = migration
+	}
+
+	v := &Verification{}
+	appliedVersions := make(map[string]bool)
+	var latestAppliedVersion time.Time
+	for _, migrationData := range appliedMigrationsData {
+		version := migrationData.version.Format(TimestampFormat)
+		appliedVersions[version] = true
+		if migrationData.version.After(latestAppliedVersion) {
+			latestAppliedVersion = migrationData.version
+		}
+
+		migration, ok := foundMigrationsMap[version]
+		if !ok {
+			v.Missing = append(v.Missing, &Migration{Version: migrationData.version, AppliedAt: migrationData.appliedAt, Direction: DirectionUp})
+			continue
 		}
+		migration.AppliedAt = migrationData.appliedAt
 
-		if mpath != migrationsDirPath && info.IsDir() {
-			return filepath.SkipDir
+		// migrations applied before checksums were recorded can't be verified
+		if migrationData.checksum == "" {
+			continue
+		}
+
+		query, err := m.readMigration(migration)
+		if err != nil {
+			return nil, err
 		}
-		if info.IsDir() {
-			return nil
+		if migrationChecksum(migration, query) != migrationData.checksum {
+			v.Changed = append(v.Changed, migration)
 		}
+	}
+
+	for _, migration := range foundMigrations {
+		if !appliedVersions[migration.Version.Format(TimestampFormat)] && migration.Version.Before(latestAppliedVersion) {
+			v.Unknown = append(v.Unknown, migration)
+		}
+	}
+
+	return v, nil
+}
 
-		migration, err := migrationFromFileName(info.Name())
+// findMigrations finds all valid migrations in the migrations source and registered Go migrations
+func (m *Migrator) findMigrations(direction Direction) ([]*Migration, error) {
+	fnames, err := m.MigrationsSource.FileNames()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't list migrations files")
+	}
+
+	var migrations []*Migration
+	for _, fname := range fnames {
+		migration, err := migrationFromFileName(fname)
 		if err != nil {
-			return nil
+			continue
 		}
 
-		if migration.Direction != direction {
-			return nil
+		if migration.SingleFile {
+			migration.Direction = direction
+		} else if migration.Direction != direction {
+			continue
 		}
 
 		// migration that should be run on isSpecific dbWrapper only
 		if migration.Engine != "" && migration.Engine != m.Engine {
-			return nil
+			continue
 		}
 
 		migrations = append(migrations, migration)
-		return nil
-	})
-	if err != nil {
-		return nil, errors.Wrap(err, "can't scan migrations directory")
 	}
+	migrations = append(migrations, registeredGoMigrations(direction)...)
 
 	sort.Sort(byVersion(migrations))
 
@@ -383,13 +1139,13 @@ func (m *Migrator) findMigrations(direction Direction) ([]*Migration, error) {
 }
 
 // unappliedMigrations returns list of all unapplied migrations
-func (m *Migrator) unappliedMigrations() ([]*Migration, error) {
+func (m *Migrator) unappliedMigrations(ctx context.Context) ([]*Migration, error) {
 	foundMigrations, err := m.findMigrations(DirectionUp)
 	if err != nil {
 		return nil, errors.Wrap(err, "can't get migrations")
 	}
 
-	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData("version ASC")
+	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData(ctx, "version ASC")
 	if err != nil {
 		return nil, err
 	}
@@ -416,25 +1172,56 @@ func (m *Migrator) unappliedMigrations() ([]*Migration, error) {
 func (m *Migrator) getMigration(version time.Time, direction Direction) (*Migration, error) {
 	versionStr := version.Format(TimestampFormat)
 
-	pattern := filepath.FromSlash(fmt.Sprintf("%s/%s.*.%v.sql", filepath.Join(m.projectDir, MigrationsDir), versionStr, direction))
-	files, _ := filepath.Glob(pattern)
+	fnames, err := m.MigrationsSource.FileNames()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't list migrations files")
+	}
+
+	// engine specific migrations are used only if there are no common ones
+	var common, specific []*Migration
+	for _, fname := range fnames {
+		migration, err := migrationFromFileName(fname)
+		if err != nil || !migration.Version.Equal(version) {
+			continue
+		}
+		if migration.SingleFile {
+			migration.Direction = direction
+		} else if migration.Direction != direction {
+			continue
+		}
 
+		switch migration.Engine {
+		case "":
+			common = append(common, migration)
+		case m.Engine:
+			specific = append(specific, migration)
+		}
+	}
+	files := common
 	if len(files) == 0 {
-		pattern = filepath.FromSlash(fmt.Sprintf("%s/%s.*.%v.%s.sql", filepath.Join(m.projectDir, MigrationsDir), versionStr, direction, m.Engine))
-		files, _ = filepath.Glob(pattern)
+		files = specific
 	}
 
-	if len(files) == 0 {
+	var goMigration *Migration
+	for _, migration := range registeredGoMigrations(direction) {
+		if migration.Version.Equal(version) {
+			goMigration = migration
+		}
+	}
+
+	count := len(files)
+	if goMigration != nil {
+		count++
+	}
+	if count == 0 {
 		return nil, errors.Errorf("migration %v with version %s does not exist", direction, versionStr)
 	}
-	if len(files) > 1 {
-		return nil, errors.Errorf("got %d %v migration with version %s, should be only one", len(files), direction, versionStr)
+	if count > 1 {
+		return nil, errors.Errorf("got %d %v migration with version %s, should be only one", count, direction, versionStr)
 	}
-
-	migration, err := migrationFromFileName(filepath.Base(files[0]))
-	if err != nil {
-		return nil, err
+	if goMigration != nil {
+		return goMigration, nil
 	}
 
-	return migration, nil
+	return files[0], nil
 }
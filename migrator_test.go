@@ -1,6 +1,10 @@
 package dbmigrate
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -30,9 +34,74 @@ func Test_NewMigrator(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "migrations", m.MigrationsTable)
 	projectDir, _ := os.Getwd()
-	assert.Equal(t, projectDir, m.projectDir)
-	assert.Equal(t, "sqlite3", m.dbWrapper.driver())
+	assert.Equal(t, DirSource(filepath.Join(projectDir, MigrationsDir)), m.MigrationsSource)
+	assert.Equal(t, "sqlite3", m.dbWrapper.provider.Driver())
 	m.Close()
+
+	s.Schema = "meta"
+	_, err = NewMigrator(s)
+	assert.EqualError(t, err, "schema is supported only by postgres, not by sqlite")
+}
+
+func Test_NewMigratorWithDB(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	_, err := NewMigratorWithDB(nil, "sqlite", nil)
+	assert.EqualError(t, err, "db is nil")
+
+	wd, _ := os.Getwd()
+	db, err := sql.Open("sqlite3", filepath.Join(wd, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = NewMigratorWithDB(db, "", nil)
+	assert.EqualError(t, err, "database engine not specified")
+	_, err = NewMigratorWithDB(db, "nosql", nil)
+	assert.EqualError(t, err, "unknown database engine nosql")
+	_, err = NewMigratorWithDB(db, "postgres", &Settings{Schema: "app"})
+	assert.EqualError(t, err, "schema can't be set for the existing connections pool, set search path of its connections instead")
+
+	// the working dir doesn't matter if migrations path is set
+	migrationsPath := filepath.Join(wd, MigrationsDir)
+	os.Chdir(os.TempDir())
+	defer os.Chdir(wd)
+
+	settings := &Settings{MigrationsPath: migrationsPath}
+	m, err := NewMigratorWithDB(db, "sqlite", settings)
+	require.NoError(t, err)
+	assert.Equal(t, DirSource(migrationsPath), m.MigrationsSource)
+	// settings passed by the caller are not changed
+	assert.Equal(t, &Settings{MigrationsPath: migrationsPath}, settings)
+
+	n, err := m.Migrate()
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// migrator doesn't close the db it didn't open
+	require.NoError(t, m.Close())
+	assert.NoError(t, db.Ping())
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM migrations").Scan(&count))
+	assert.Equal(t, 3, count)
+}
+
+func Test_Settings_migrationsPath(t *testing.T) {
+	s := &Settings{MigrationsPath: "/srv/app/migrations"}
+	path, err := s.migrationsPath()
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/app/migrations", path)
+
+	// the database path is relative to the parent dir of the migrations path
+	dsn, err := (&sqliteProvider{}).DSN(&Settings{MigrationsPath: "/srv/app/migrations", Database: "data/test.db"})
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/app/data/test.db", dsn)
+
+	wd, _ := os.Getwd()
+	s.MigrationsPath = ""
+	path, err = s.migrationsPath()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(wd, MigrationsDir), path)
 }
 
 func Test_Migrator_Close(t *testing.T) {
@@ -40,8 +109,6 @@ func Test_Migrator_Close(t *testing.T) {
 	require.NoError(t, err)
 	err = m.Close()
 	assert.NoError(t, err)
-	assert.Nil(t, m.MigrationsCh)
-	assert.Nil(t, m.ErrorsCh)
 }
 
 func Test_Migrator_getMigration(t *testing.T) {
@@ -111,7 +178,7 @@ func Test_Migrator_unappliedMigrations(t *testing.T) {
 	migrations, _ := m.findMigrations(DirectionUp)
 
 	for i := 0; i < 4; i++ {
-		unappliedMigrations, err := m.unappliedMigrations()
+		unappliedMigrations, err := m.unappliedMigrations(context.Background())
 		require.NoError(t, err)
 		assert.Len(t, unappliedMigrations, 3-i)
 
@@ -121,7 +188,7 @@ func Test_Migrator_unappliedMigrations(t *testing.T) {
 		}
 
 		if i < 3 {
-			m.dbWrapper.insertMigrationData(migrations[i].Version, time.Now(), nil)
+			m.dbWrapper.insertMigrationData(context.Background(), &migrationData{version: migrations[i].Version, appliedAt: time.Now(), batch: i + 1}, nil)
 		}
 	}
 }
@@ -161,7 +228,7 @@ func TestMigrator_Migrator_LatestVersionAndLastAppliedMigration(t *testing.T) {
 	v1 := time.Date(2018, 9, 18, 20, 4, 53, 0, time.UTC)
 	v2 := time.Date(2018, 9, 18, 20, 6, 32, 0, time.UTC)
 
-	_ = m.dbWrapper.insertMigrationData(v1, time.Now(), nil)
+	_ = m.dbWrapper.insertMigrationData(context.Background(), &migrationData{version: v1, appliedAt: time.Now(), batch: 1}, nil)
 	lvm, err = m.LatestVersionMigration()
 	require.NoError(t, err)
 	assert.Equal(t, v1, lvm.Version)
@@ -170,7 +237,7 @@ func TestMigrator_Migrator_LatestVersionAndLastAppliedMigration(t *testing.T) {
 	assert.Equal(t, v1, lam.Version)
 
 	// earlier applied_at
-	_ = m.dbWrapper.insertMigrationData(v2, time.Now().Add(-5*time.Second), nil)
+	_ = m.dbWrapper.insertMigrationData(context.Background(), &migrationData{version: v2, appliedAt: time.Now().Add(-5 * time.Second), batch: 1}, nil)
 	lvm, err = m.LatestVersionMigration()
 	require.NoError(t, err)
 	assert.Equal(t, v2, lvm.Version)
@@ -179,7 +246,7 @@ func TestMigrator_Migrator_LatestVersionAndLastAppliedMigration(t *testing.T) {
 	assert.Equal(t, v1, lam.Version)
 
 	// not existing migration
-	_ = m.dbWrapper.insertMigrationData(time.Date(2018, 9, 18, 22, 2, 34, 0, time.UTC), time.Now(), nil)
+	_ = m.dbWrapper.insertMigrationData(context.Background(), &migrationData{version: time.Date(2018, 9, 18, 22, 2, 34, 0, time.UTC), appliedAt: time.Now(), batch: 1}, nil)
 	_, err = m.LatestVersionMigration()
 	assert.Contains(t, err.Error(), "can't get latest migration with version")
 	_, err = m.LastAppliedMigration()
@@ -189,55 +256,48 @@ func TestMigrator_Migrator_LatestVersionAndLastAppliedMigration(t *testing.T) {
 func Test_Migrator_run(t *testing.T) {
 	os.Remove("test.db")
 
-	migrationsCh := make(chan *Migration)
-	errorsCh := make(chan error)
-	done := make(chan struct{})
-
-	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db", MigrationsCh: migrationsCh, ErrorsCh: errorsCh})
+	observer := &recordingObserver{}
+	logger := &recordingLogger{}
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db", Observer: observer, Logger: logger})
 	defer m.Close()
 
 	migration, _ := migrationFromFileName("20180918100423.incorrect.up.sql")
-	err := m.run(migration)
+	err := m.run(context.Background(), migration)
 	assert.Contains(t, err.Error(), "can't read migration")
+	assert.Equal(t, []EventType{EventMigrationStarted, EventMigrationFailed}, observer.types())
+	assert.Equal(t, err, observer.events[1].Err)
 
 	migration, _ = migrationFromFileName("20180918200742.wrong_engine.up.postgres.sql")
-	err = m.run(migration)
+	err = m.run(context.Background(), migration)
 	assert.EqualError(t, err, "empty query")
 
-	go func() {
-		migration := <-migrationsCh
-		assert.Equal(t, time.Date(2018, 9, 18, 20, 4, 53, 0, time.UTC), migration.Version)
-		done <- struct{}{}
-	}()
+	observer.events = nil
 	migration, _ = migrationFromFileName("20180918200453.correct.up.sql")
-	err = m.run(migration)
+	err = m.run(context.Background(), migration)
 	require.NoError(t, err)
-	<-done
+	assert.Equal(t, []EventType{EventMigrationStarted, EventStatementExecuted, EventMigrationFinished}, observer.types())
+	assert.Equal(t, migration, observer.events[2].Migration)
+	assert.Equal(t, 1, observer.events[1].Statement.Line)
+	require.Len(t, logger.statements, 1)
+	assert.Contains(t, logger.statements[0].Query, "CREATE TABLE posts")
 
 	migration, _ = migrationFromFileName("20180918200742.wrong_engine.down.postgres.sql")
-	err = m.run(migration)
+	err = m.run(context.Background(), migration)
 	assert.EqualError(t, err, "empty query")
 
-	go func() {
-		err := <-errorsCh
-		assert.EqualError(t, err, "empty query")
-		done <- struct{}{}
-	}()
-
+	observer.events = nil
 	m.AllowMissingDowns = true
-	m.ErrorsCh = errorsCh
-	err = m.run(migration)
+	err = m.run(context.Background(), migration)
 	require.NoError(t, err)
-	<-done
+	assert.Equal(t, []EventType{EventMigrationStarted, EventMigrationSkipped}, observer.types())
+	assert.EqualError(t, observer.events[1].Err, "empty query")
 }
 
 func Test_Migrator_Migrate_Rollback(t *testing.T) {
 	os.Remove("test.db")
 
-	errorsCh := make(chan error)
-	done := make(chan struct{})
-
-	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db", ErrorsCh: errorsCh})
+	observer := &recordingObserver{}
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db", Observer: observer})
 	defer m.Close()
 
 	n, err := m.Rollback()
@@ -265,17 +325,13 @@ func Test_Migrator_Migrate_Rollback(t *testing.T) {
 	assert.Contains(t, err.Error(), "can't get migration for")
 	assert.Equal(t, 0, n)
 
-	go func() {
-		err := <-errorsCh
-		assert.Contains(t, err.Error(), "can't get migration for")
-		done <- struct{}{}
-	}()
-
+	observer.events = nil
 	m.AllowMissingDowns = true
 	n, err = m.Rollback()
 	require.NoError(t, err)
 	assert.Equal(t, 0, n)
-	<-done
+	require.Equal(t, []EventType{EventWarning}, observer.types())
+	assert.Contains(t, observer.events[0].Err.Error(), "can't get migration for")
 	m.AllowMissingDowns = false
 
 	os.Rename("20180918200453.correct.down.sql", filepath.Join(MigrationsDir, "20180918200453.correct.down.sql"))
@@ -414,6 +470,71 @@ func Test_Migrator_GenerateMigration(t *testing.T) {
 	}
 }
 
+func Test_Migrator_GenerateSingleFileMigration(t *testing.T) {
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	fpaths, err := m.GenerateSingleFileMigration("Single file", "sqlite")
+	require.NoError(t, err)
+	require.Len(t, fpaths, 1)
+	defer os.Remove(fpaths[0])
+	assert.Regexp(t, `^`+MigrationsDir+`/\d+\.single_file\.sqlite\.sql$`, fpaths[0])
+
+	content, _ := ioutil.ReadFile(fpaths[0])
+	assert.Equal(t, "-- +migrate up\n\n-- +migrate down\n", string(content))
+
+	_, err = m.GenerateSingleFileMigration("Single file", "sqlite")
+	assert.Contains(t, err.Error(), "already exists")
+}
+
+func Test_Migrator_singleFileMigrations(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	fpath := filepath.Join(MigrationsDir, "20180918200500.single_file.sql")
+	ioutil.WriteFile(fpath, []byte("-- +migrate up\nCREATE TABLE users (name VARCHAR NOT NULL);\n\n-- +migrate down\nDROP TABLE users;\n"), 0644)
+	defer os.Remove(fpath)
+
+	migrations, err := m.findMigrations(DirectionUp)
+	require.NoError(t, err)
+	require.Len(t, migrations, 4)
+	assert.Equal(t, "20180918200500.single_file.sql", migrations[1].FileName())
+	assert.Equal(t, DirectionUp, migrations[1].Direction)
+
+	migration, err := m.getMigration(migrations[1].Version, DirectionDown)
+	require.NoError(t, err)
+	assert.True(t, migration.SingleFile)
+	assert.Equal(t, DirectionDown, migration.Direction)
+	query, err := m.readMigration(migration)
+	require.NoError(t, err)
+	assert.Equal(t, "\n\n\n\nDROP TABLE users;\n", string(query))
+
+	n, err := m.MigrateSteps(2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, err = m.dbWrapper.db.Exec("SELECT * FROM users")
+	assert.NoError(t, err)
+
+	v, _ := m.Verify()
+	assert.False(t, v.HasDrift())
+
+	n, err = m.RollbackSteps(1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = m.dbWrapper.db.Exec("SELECT * FROM users")
+	assert.Error(t, err)
+
+	// two-file and single-file migrations with the same version are duplicates
+	dupPath := filepath.Join(MigrationsDir, "20180918200453.correct.sql")
+	ioutil.WriteFile(dupPath, []byte("-- +migrate up\nSELECT 1;"), 0644)
+	defer os.Remove(dupPath)
+	_, err = m.findMigrations(DirectionUp)
+	assert.Error(t, err)
+}
+
 func Test_Migrator_Status(t *testing.T) {
 	os.Remove("test.db")
 
@@ -432,3 +553,438 @@ func Test_Migrator_Status(t *testing.T) {
 		}
 	}
 }
+
+func Test_Migrator_Lock(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m1, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m1.Close()
+	m2, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db", LockTimeout: 200 * time.Millisecond})
+	defer m2.Close()
+
+	assert.Equal(t, DefaultLockTimeout, m1.LockTimeout)
+
+	err := m1.Unlock()
+	assert.EqualError(t, err, "migrations lock is not held")
+
+	// nested locks
+	require.NoError(t, m1.Lock())
+	require.NoError(t, m1.Lock())
+
+	// migrations and rollbacks can be run by the lock holder only
+	n, err := m1.MigrateSteps(1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = m2.MigrateSteps(1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't acquire migrations lock")
+	_, err = m2.Rollback()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't acquire migrations lock")
+
+	require.NoError(t, m1.Unlock())
+	_, err = m2.Rollback()
+	require.Error(t, err)
+
+	require.NoError(t, m1.Unlock())
+	n, err = m2.Rollback()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// negative lock timeout means not waiting for the lock
+	m3, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db", LockTimeout: -1})
+	defer m3.Close()
+	require.NoError(t, m1.Lock())
+	start := time.Now()
+	err = m3.Lock()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "gave up after 0s")
+	assert.True(t, time.Since(start) < 200*time.Millisecond)
+	require.NoError(t, m1.Unlock())
+
+	// lock is released on close
+	require.NoError(t, m1.Lock())
+	m1.Close()
+	require.NoError(t, m2.Lock())
+	require.NoError(t, m2.Unlock())
+}
+
+func Test_Migrator_MigrateContext_RollbackContext(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	n, err := m.MigrateContext(ctx, AllSteps)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	cancel()
+
+	_, err = m.RollbackContext(ctx, 0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+
+	_, err = m.StatusContext(ctx)
+	require.Error(t, err)
+
+	// nothing has been rolled back
+	migrations, err := m.Status()
+	require.NoError(t, err)
+	for _, migration := range migrations {
+		assert.NotEqual(t, time.Time{}, migration.AppliedAt)
+	}
+}
+
+func Test_Migrator_Verify(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	v, err := m.Verify()
+	require.NoError(t, err)
+	assert.False(t, v.HasDrift())
+
+	m.Migrate()
+	v, err = m.Verify()
+	require.NoError(t, err)
+	assert.False(t, v.HasDrift())
+
+	// changed migration
+	fpath := filepath.Join(MigrationsDir, "20180918200453.correct.up.sql")
+	content, _ := ioutil.ReadFile(fpath)
+	ioutil.WriteFile(fpath, []byte("CREATE TABLE changed (title VARCHAR NOT NULL);"), 0644)
+	v, err = m.Verify()
+	require.NoError(t, err)
+	assert.True(t, v.HasDrift())
+	require.Len(t, v.Changed, 1)
+	assert.Equal(t, "correct", v.Changed[0].Name)
+	ioutil.WriteFile(fpath, content, 0644)
+
+	// missing and unknown migrations
+	os.Rename(filepath.Join(MigrationsDir, "20180918201019.specific_engine_correct.up.sqlite.sql"), "20180918201019.specific_engine_correct.up.sqlite.sql")
+	m.dbWrapper.deleteMigrationVersion(context.Background(), time.Date(2018, 9, 18, 20, 4, 53, 0, time.UTC), nil)
+	v, err = m.Verify()
+	require.NoError(t, err)
+	assert.Empty(t, v.Changed)
+	require.Len(t, v.Missing, 1)
+	assert.Equal(t, time.Date(2018, 9, 18, 20, 10, 19, 0, time.UTC), v.Missing[0].Version)
+	require.Len(t, v.Unknown, 1)
+	assert.Equal(t, "correct", v.Unknown[0].Name)
+	os.Rename("20180918201019.specific_engine_correct.up.sqlite.sql", filepath.Join(MigrationsDir, "20180918201019.specific_engine_correct.up.sqlite.sql"))
+
+	// migrations applied before checksums were recorded are not checked
+	m.dbWrapper.db.Exec("UPDATE migrations SET checksum = NULL")
+	ioutil.WriteFile(fpath, []byte("CREATE TABLE changed (title VARCHAR NOT NULL);"), 0644)
+	v, err = m.Verify()
+	require.NoError(t, err)
+	assert.Empty(t, v.Changed)
+	ioutil.WriteFile(fpath, content, 0644)
+}
+
+func Test_NewMigrator_upgradesMigrationsTable(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	db, _ := sql.Open("sqlite3", "test.db")
+	_, err := db.Exec("CREATE TABLE migrations (version VARCHAR(14) NOT NULL, applied_at VARCHAR(14) NOT NULL, PRIMARY KEY(version));")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO migrations (version, applied_at) VALUES ('20180918200453', '20180920100000'), ('20180918200632', '20180920100000'), ('20180918201020', '20180921100000');")
+	require.NoError(t, err)
+	db.Close()
+
+	m, err := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	require.NoError(t, err)
+	defer m.Close()
+	for _, column := range []string{"checksum", "batch"} {
+		hasColumn, err := m.dbWrapper.hasMigrationsTableColumn(context.Background(), column)
+		require.NoError(t, err)
+		assert.True(t, hasColumn)
+	}
+
+	mds, err := m.dbWrapper.appliedMigrationsData(context.Background(), "version ASC")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1, 2}, []int{mds[0].batch, mds[1].batch, mds[2].batch})
+	assert.Equal(t, time.Date(2018, 9, 20, 10, 0, 0, 0, time.UTC), mds[0].appliedAt)
+	assert.Equal(t, time.Date(2018, 9, 21, 10, 0, 0, 0, time.UTC), mds[2].appliedAt)
+	for _, column := range []string{"duration_ms", "applied_by", "host", "dbmigrate_version"} {
+		hasColumn, err := m.dbWrapper.hasMigrationsTableColumn(context.Background(), column)
+		require.NoError(t, err)
+		assert.True(t, hasColumn)
+	}
+
+	version, err := m.dbWrapper.migrationsTableSchemaVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, migrationsTableVersion, version)
+
+	// migrations applied by the current version have all the metadata
+	_, err = m.MigrateSteps(1)
+	require.NoError(t, err)
+	migrations, _ := m.Status()
+	assert.Equal(t, 3, migrations[2].Batch)
+	assert.Equal(t, m.user, migrations[2].AppliedBy)
+	assert.Equal(t, m.host, migrations[2].Host)
+	mds, _ = m.dbWrapper.appliedMigrationsData(context.Background(), "batch DESC")
+	assert.Equal(t, Version, mds[0].dbmigrateVersion)
+}
+
+func Test_NewMigrator_createsMigrationsTable(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	// processes connecting to the empty database at the same time create tables only once
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			m, err := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+			if err == nil {
+				m.Close()
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+	os.Remove("test.db")
+
+	// tables left by the process which crashed before the schema version was stored are upgraded
+	db, _ := sql.Open("sqlite3", "test.db")
+	w := newDBWrapper(&Settings{Engine: "sqlite", MigrationsTable: "migrations"}, providers["sqlite"])
+	_, err := db.Exec(w.migrationsTableQuery("migrations"))
+	require.NoError(t, err)
+	w.db = db
+	require.NoError(t, w.createHistoryTable(context.Background()))
+	db.Close()
+
+	m, err := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	require.NoError(t, err)
+	defer m.Close()
+	version, err := m.dbWrapper.migrationsTableSchemaVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, migrationsTableVersion, version)
+}
+
+func Test_Migrator_RollbackBatch(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	// batches don't depend on applied at times, so all migrations can be applied during the same second
+	_, err := m.MigrateSteps(2)
+	require.NoError(t, err)
+	_, err = m.MigrateSteps(1)
+	require.NoError(t, err)
+
+	migrations, err := m.Status()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1, 2}, []int{migrations[0].Batch, migrations[1].Batch, migrations[2].Batch})
+
+	_, err = m.RollbackBatch(3)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "batch 3 does not exist")
+
+	p, err := m.PlanBatch(1)
+	require.NoError(t, err)
+	assert.Len(t, p.Steps, 2)
+
+	n, err := m.RollbackBatch(1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	migrations, _ = m.Status()
+	assert.Equal(t, []int{0, 0, 2}, []int{migrations[0].Batch, migrations[1].Batch, migrations[2].Batch})
+
+	// the next migrate operation gets the number following the last one
+	_, err = m.Migrate()
+	require.NoError(t, err)
+	migrations, _ = m.Status()
+	assert.Equal(t, []int{3, 3, 2}, []int{migrations[0].Batch, migrations[1].Batch, migrations[2].Batch})
+
+	n, err = m.Rollback()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	lam, _ := m.LastAppliedMigration()
+	assert.Equal(t, migrations[2].Version, lam.Version)
+}
+
+func Test_Migrator_run_noTransaction(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	fpath := filepath.Join(MigrationsDir, "20180918202020.no_transaction.up.sql")
+	ioutil.WriteFile(fpath, []byte("-- dbmigrate:no-transaction\nCREATE TABLE users (name VARCHAR NOT NULL);\nERROR;"), 0644)
+	defer os.Remove(fpath)
+
+	migration, _ := migrationFromFileName(filepath.Base(fpath))
+	err := m.run(context.Background(), migration)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "migration is not transactional, 1 of 2 statements have been executed")
+	lm, _ := m.LatestVersionMigration()
+	assert.Nil(t, lm)
+
+	// migrations are not run until the dirty state is repaired
+	ioutil.WriteFile(fpath, []byte("-- dbmigrate:no-transaction\nCREATE TABLE tags (name VARCHAR NOT NULL);"), 0644)
+	err = m.run(context.Background(), migration)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database is dirty")
+	require.NoError(t, m.Repair(false))
+
+	err = m.run(context.Background(), migration)
+	require.NoError(t, err)
+	lm, _ = m.LatestVersionMigration()
+	assert.Equal(t, migration.Version, lm.Version)
+}
+
+func Test_Migrator_MigrateTo_RollbackTo(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	v1 := time.Date(2018, 9, 18, 20, 4, 53, 0, time.UTC)
+	v2 := time.Date(2018, 9, 18, 20, 6, 32, 0, time.UTC)
+	v3 := time.Date(2018, 9, 18, 20, 10, 19, 0, time.UTC)
+
+	_, err := m.MigrateTo(time.Date(2018, 9, 18, 20, 5, 0, 0, time.UTC))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't find target migration")
+
+	n, err := m.MigrateTo(v2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	lm, _ := m.LatestVersionMigration()
+	assert.Equal(t, v2, lm.Version)
+
+	n, err = m.MigrateTo(v2)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	n, err = m.MigrateTo(v3)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = m.RollbackTo(time.Date(2018, 9, 18, 20, 5, 0, 0, time.UTC))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't find target migration")
+
+	n, err = m.RollbackTo(v1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	lm, _ = m.LatestVersionMigration()
+	assert.Equal(t, v1, lm.Version)
+
+	n, err = m.RollbackTo(v1)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func Test_Migrator_ResolveVersion(t *testing.T) {
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+	defer os.Remove("test.db")
+
+	v, err := m.ResolveVersion("20180918200632")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2018, 9, 18, 20, 6, 32, 0, time.UTC), v)
+
+	v, err = m.ResolveVersion("other_correct")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2018, 9, 18, 20, 6, 32, 0, time.UTC), v)
+
+	v, err = m.ResolveVersion(" Specific engine  correct")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2018, 9, 18, 20, 10, 19, 0, time.UTC), v)
+
+	_, err = m.ResolveVersion("20180918200742")
+	assert.EqualError(t, err, "migration with version 20180918200742 does not exist in dbmigrations")
+
+	_, err = m.ResolveVersion("wrong_engine")
+	assert.EqualError(t, err, "migration with name wrong_engine does not exist in dbmigrations")
+
+	os.Create(filepath.Join(MigrationsDir, "20180918202020.correct.up.sql"))
+	defer os.Remove(filepath.Join(MigrationsDir, "20180918202020.correct.up.sql"))
+	_, err = m.ResolveVersion("correct")
+	assert.EqualError(t, err, "there are 2 migrations with name correct, use version instead")
+}
+
+func Test_Migrator_Plan(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	_, err := m.Plan(directionError, AllSteps)
+	assert.EqualError(t, err, "can't plan, incorrect direction")
+
+	plan, err := m.Plan(DirectionUp, 2)
+	require.NoError(t, err)
+	assert.Equal(t, DirectionUp, plan.Direction)
+	require.Len(t, plan.Steps, 2)
+	assert.Equal(t, "20180918200453.correct.up.sql", plan.Steps[0].Migration.FileName())
+	assert.True(t, plan.Steps[0].Transactional)
+	assert.Equal(t, []string{
+		"CREATE TABLE posts (title VARCHAR NOT NULL, content TEXT NOT NULL, PRIMARY KEY(title))",
+		fmt.Sprintf("INSERT INTO migrations (version, applied_at, duration_ms, batch, checksum, applied_by, host, dbmigrate_version, baselined) "+
+			"VALUES ('20180918200453', '%s', '0', '1', '%s', '%s', '%s', '%s', '0')",
+			plan.Steps[0].Migration.AppliedAt.Format(dbTimestampFormat),
+			checksum([]byte("CREATE TABLE posts (title VARCHAR NOT NULL, content TEXT NOT NULL, PRIMARY KEY(title));")),
+			m.user, m.host, Version),
+	}, plan.Steps[0].Statements[:2])
+	assert.Contains(t, plan.Steps[0].Statements[2], "INSERT INTO migrations_history (version, name, direction, executed_at, duration_ms, batch, manual, error, "+
+		"executed_by, host, dbmigrate_version) VALUES ('20180918200453', 'correct', 'up', '")
+	assert.Contains(t, plan.Steps[0].Statements[2], fmt.Sprintf("'0', '1', '0', NULL, '%s', '%s', '%s')", m.user, m.host, Version))
+	assert.Equal(t, "20180918200632.other_correct.up.sql", plan.Steps[1].Migration.FileName())
+
+	// plan doesn't change the database
+	lm, _ := m.LastAppliedMigration()
+	assert.Nil(t, lm)
+
+	plan, err = m.Plan(DirectionDown, 0)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Steps)
+
+	n, _ := m.Migrate()
+	assert.Equal(t, 3, n)
+
+	plan, err = m.Plan(DirectionDown, 0)
+	require.NoError(t, err)
+	assert.Equal(t, DirectionDown, plan.Direction)
+	require.Len(t, plan.Steps, 3)
+	assert.Equal(t, "20180918201019.specific_engine_correct.down.sqlite.sql", plan.Steps[0].Migration.FileName())
+	assert.Equal(t, []string{"DROP TABLE comments", "DROP TABLE tags", "DELETE FROM migrations WHERE version = '20180918201019'"},
+		plan.Steps[0].Statements[:3])
+	assert.Contains(t, plan.Steps[0].Statements[3], "INSERT INTO migrations_history")
+
+	reversed, err := m.ReversePlan(plan)
+	require.NoError(t, err)
+	assert.Equal(t, DirectionUp, reversed.Direction)
+	require.Len(t, reversed.Steps, 3)
+	assert.Equal(t, "20180918200453.correct.up.sql", reversed.Steps[0].Migration.FileName())
+	assert.Equal(t, "20180918201019.specific_engine_correct.up.sqlite.sql", reversed.Steps[2].Migration.FileName())
+
+	plan, err = m.PlanTo(DirectionDown, time.Date(2018, 9, 18, 20, 4, 53, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Len(t, plan.Steps, 2)
+
+	plan, err = m.PlanTo(DirectionUp, time.Date(2018, 9, 18, 20, 4, 53, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Empty(t, plan.Steps)
+
+	lm, _ = m.LatestVersionMigration()
+	assert.Equal(t, time.Date(2018, 9, 18, 20, 10, 19, 0, time.UTC), lm.Version)
+}
@@ -1,26 +1,34 @@
 package dbmigrate
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
-	// mysql driver, imported only to exec init function
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 func init() {
-	providers["mysql"] = &mysqlProvider{}
+	RegisterProvider("mysql", &mysqlProvider{})
 }
 
-// mysqlProvider is the provider interface implementation for mysql
+// mysqlProvider is the Provider and SchemaDumpProvider interfaces implementation for mysql
 type mysqlProvider struct {
 	defaultProvider
 }
 
-func (p *mysqlProvider) driver() string {
+func (p *mysqlProvider) Driver() string {
 	return "mysql"
 }
 
-func (p *mysqlProvider) dsn(settings *Settings) (string, error) {
+func (p *mysqlProvider) DSN(settings *Settings) (string, error) {
 	if settings.Database == "" {
 		return "", errDBNameNotProvided
 	}
@@ -29,14 +37,117 @@ func (p *mysqlProvider) dsn(settings *Settings) (string, error) {
 		return "", errUserNotProvided
 	}
 
-	host := settings.Host
-	if host == "" {
-		host = "127.0.0.1"
+	// host starting with slash is the path to unix socket
+	address := fmt.Sprintf("unix(%s)", settings.Host)
+	if !strings.HasPrefix(settings.Host, "/") {
+		host := settings.Host
+		if host == "" {
+			host = "127.0.0.1"
+		}
+		port := settings.Port
+		if port == 0 {
+			port = 3306
+		}
+		address = fmt.Sprintf("tcp(%s:%d)", host, port)
+	}
+
+	// parseTime is required to scan DATETIME columns, but it still can be overridden
+	params := url.Values{"parseTime": {"true"}}
+	config, err := tlsConfig(settings)
+	if err != nil {
+		return "", err
+	}
+	if config != nil {
+		// the driver refers to TLS configs by names they are registered with
+		name := tlsConfigName(settings)
+		err = mysql.RegisterTLSConfig(name, config)
+		if err != nil {
+			return "", errors.Wrap(err, "can't register TLS config")
+		}
+		params.Set("tls", name)
 	}
-	port := settings.Port
-	if port == 0 {
-		port = 3306
+	for k, v := range settings.Params {
+		params.Set(k, v)
 	}
 
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", settings.User, settings.Password, host, port, settings.Database), nil
+	return fmt.Sprintf("%s:%s@%s/%s?%s", settings.User, settings.Password, address, settings.Database, params.Encode()), nil
+}
+
+func (p *mysqlProvider) TimestampType() string {
+	// unlike DATETIME, TIMESTAMP columns are limited to 2038 and may be updated automatically
+	return "DATETIME"
+}
+
+func (p *mysqlProvider) SerialPrimaryKeyType() string {
+	return "INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY"
+}
+
+func (p *mysqlProvider) SplitStatements(query string) ([]*Statement, error) {
+	return SplitStatements(query, &SQLDialect{BackslashEscapes: true, HashComments: true, DashCommentsNeedSpace: true, ExecutableComments: true})
+}
+
+func (p *mysqlProvider) DumpSchema(ctx context.Context, db *sql.DB, excluded []string) ([]string, error) {
+	// base tables are sorted before views
+	rows, err := db.QueryContext(ctx, "SELECT table_name, table_type FROM information_schema.tables WHERE table_schema = DATABASE() "+
+		"ORDER BY table_type, table_name")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't select tables")
+	}
+	var names, types []string
+	for rows.Next() {
+		var name, typ string
+		err = rows.Scan(&name, &typ)
+		if err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "can't scan table")
+		}
+		if !isExcluded(name, excluded) {
+			names, types = append(names, name), append(types, typ)
+		}
+	}
+	rows.Close()
+
+	// information_schema doesn't hold whole definitions, so they are taken from SHOW CREATE statements, which include indexes
+	var statements []string
+	for i, name := range names {
+		var statement string
+		if types[i] == "VIEW" {
+			var charset, collation string
+			err = db.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE VIEW `%s`", name)).Scan(&name, &statement, &charset, &collation)
+		} else {
+			err = db.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE TABLE `%s`", name)).Scan(&name, &statement)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't get definition of %s", name)
+		}
+		statements = append(statements, p.normalizeCreateStatement(statement))
+	}
+	return statements, nil
+}
+
+// mysqlVolatileClausesRegexp matches clauses of SHOW CREATE statements depending on the data or the user, rather than on the schema
+var mysqlVolatileClausesRegexp = regexp.MustCompile(` AUTO_INCREMENT=\d+| DEFINER=\S+`)
+
+// normalizeCreateStatement removes clauses which would change the schema dump without changing the schema
+func (p *mysqlProvider) normalizeCreateStatement(statement string) string {
+	return mysqlVolatileClausesRegexp.ReplaceAllString(statement, "")
+}
+
+func (p *mysqlProvider) Lock(ctx context.Context, conn *sql.Conn, table string, timeout time.Duration) error {
+	// GET_LOCK locks are server wide, so the lock name includes the database name
+	var result sql.NullInt64
+	err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(CONCAT('dbmigrate.', DATABASE(), '.', ?), ?)",
+		table, int(math.Ceil(timeout.Seconds()))).Scan(&result)
+	if err != nil {
+		return err
+	}
+	if !result.Valid || result.Int64 != 1 {
+		return errors.Errorf("lock is held by another process, gave up after %s", timeout)
+	}
+	return nil
+}
+
+func (p *mysqlProvider) Unlock(conn *sql.Conn, table string) error {
+	_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(CONCAT('dbmigrate.', DATABASE(), '.', ?))", table)
+	return err
 }
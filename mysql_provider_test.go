@@ -12,30 +12,77 @@ func Test_mysqlProviderExist(t *testing.T) {
 	assert.True(t, ok)
 }
 
-func Test_mysqlProvider_driver(t *testing.T) {
-	assert.Equal(t, "mysql", (&mysqlProvider{}).driver())
+func Test_mysqlProvider_Driver(t *testing.T) {
+	assert.Equal(t, "mysql", (&mysqlProvider{}).Driver())
 }
 
-func Test_mysqlProvider_dsn(t *testing.T) {
+func Test_mysqlProvider_DSN(t *testing.T) {
 	p := &mysqlProvider{}
 	s := &Settings{}
 
-	_, err := p.dsn(s)
+	_, err := p.DSN(s)
 	assert.EqualError(t, err, errDBNameNotProvided.Error())
 
 	s.Database = "test"
-	_, err = p.dsn(s)
+	_, err = p.DSN(s)
 	assert.EqualError(t, err, errUserNotProvided.Error())
 
 	s.User = "root"
-	dsn, err := p.dsn(s)
+	dsn, err := p.DSN(s)
 	require.NoError(t, err)
 	assert.Equal(t, "root:@tcp(127.0.0.1:3306)/test?parseTime=true", dsn)
 
 	s.Password = "12345"
 	s.Host = "myhost"
 	s.Port = 3307
-	dsn, err = p.dsn(s)
+	dsn, err = p.DSN(s)
 	require.NoError(t, err)
 	assert.Equal(t, "root:12345@tcp(myhost:3307)/test?parseTime=true", dsn)
+
+	s.Params = map[string]string{"charset": "utf8mb4", "parseTime": "false"}
+	dsn, err = p.DSN(s)
+	require.NoError(t, err)
+	assert.Equal(t, "root:12345@tcp(myhost:3307)/test?charset=utf8mb4&parseTime=false", dsn)
+
+	s.Params = nil
+	s.Host = "/var/run/mysqld/mysqld.sock"
+	dsn, err = p.DSN(s)
+	require.NoError(t, err)
+	assert.Equal(t, "root:12345@unix(/var/run/mysqld/mysqld.sock)/test?parseTime=true", dsn)
+
+	s.SSLMode = SSLModeRequire
+	dsn, err = p.DSN(s)
+	require.NoError(t, err)
+	assert.Equal(t, "root:12345@unix(/var/run/mysqld/mysqld.sock)/test?parseTime=true&tls="+tlsConfigName(s), dsn)
+
+	s.SSLMode, s.SSLCA = SSLModeVerifyFull, "nonexistent.pem"
+	_, err = p.DSN(s)
+	assert.Error(t, err)
+}
+
+func Test_mysqlProvider_SplitStatements(t *testing.T) {
+	p := &mysqlProvider{}
+
+	query := `# hash comment;
+INSERT INTO posts (title) VALUES ('it\'s; escaped'), ("double \" quoted;");
+SELECT 5--1;
+CREATE TRIGGER posts_bi BEFORE INSERT ON posts FOR EACH ROW
+BEGIN
+	IF NEW.title = '' THEN
+		SET NEW.title = 'untitled';
+	END IF;
+	CASE NEW.kind
+		WHEN 1 THEN SET NEW.kind = 2;
+		ELSE BEGIN END;
+	END CASE;
+END;
+/*!40101 SET NAMES utf8 */;`
+	statements, err := p.SplitStatements(query)
+	require.NoError(t, err)
+	require.Len(t, statements, 4)
+	assert.Equal(t, 2, statements[0].Line)
+	assert.Equal(t, "SELECT 5--1", statements[1].Query)
+	assert.Equal(t, 4, statements[2].Line)
+	assert.Contains(t, statements[2].Query, "END CASE;\nEND")
+	assert.Equal(t, "/*!40101 SET NAMES utf8 */", statements[3].Query)
 }
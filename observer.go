@@ -0,0 +1,90 @@
+package dbmigrate
+
+import (
+	"time"
+)
+
+// EventType specifies what happened during migrations execution
+type EventType int
+
+const (
+	// eventTypeError is just to start the iota cycle and to specify that the default EventType value is incorrect
+	eventTypeError = EventType(iota)
+	// EventMigrationStarted is sent before the migration is executed
+	EventMigrationStarted
+	// EventStatementExecuted is sent after each statement of SQL migration is executed
+	EventStatementExecuted
+	// EventMigrationFinished is sent after the migration is executed and recorded
+	EventMigrationFinished
+	// EventMigrationSkipped is sent if the empty down migration is skipped, which is allowed by Settings.AllowMissingDowns
+	EventMigrationSkipped
+	// EventMigrationFailed is sent if the migration execution failed
+	EventMigrationFailed
+	// EventWarning is sent for errors that happened during the work but are not fatal,
+	// e.g. missing down migrations, which are allowed by Settings.AllowMissingDowns
+	EventWarning
+)
+
+// String returns string representation of event type
+func (t EventType) String() string {
+	switch t {
+	case EventMigrationStarted:
+		return "migration started"
+	case EventStatementExecuted:
+		return "statement executed"
+	case EventMigrationFinished:
+		return "migration finished"
+	case EventMigrationSkipped:
+		return "migration skipped"
+	case EventMigrationFailed:
+		return "migration failed"
+	case EventWarning:
+		return "warning"
+	}
+	return "unknown"
+}
+
+// Event describes what happened during migrations execution
+type Event struct {
+	Type EventType
+	// Migration is the migration the event is related to, it can be nil for warnings
+	Migration *Migration
+	// Statement is the executed statement for EventStatementExecuted
+	Statement *Statement
+	// RowsAffected is the number of rows affected by the statement for EventStatementExecuted,
+	// -1 if the statement doesn't change rows or the driver can't tell it
+	RowsAffected int64
+	// Duration is the duration of the statement execution for EventStatementExecuted
+	// and of the migration execution for EventMigrationFinished and EventMigrationFailed
+	Duration time.Duration
+	// Err is the error for EventMigrationFailed and EventWarning, and the reason for EventMigrationSkipped
+	Err error
+}
+
+// Observer is notified about migrations execution events, e.g. to log them or to collect metrics.
+// Observe is called synchronously by the goroutine executing migrations, so it should not block
+type Observer interface {
+	Observe(event *Event)
+}
+
+// ObserverFunc is an adapter to allow the use of ordinary functions as observers
+type ObserverFunc func(event *Event)
+
+// Observe calls f(event)
+func (f ObserverFunc) Observe(event *Event) {
+	f(event)
+}
+
+// Logger receives statements executed by SQL migrations, with their durations, e.g. to find slow ones
+type Logger interface {
+	// LogStatement is called after the statement of the migration is executed,
+	// rowsAffected is -1 if the statement doesn't change rows or the driver can't tell it
+	LogStatement(migration *Migration, statement *Statement, duration time.Duration, rowsAffected int64)
+}
+
+// notify sends the event to the observer, if it is set
+func (m *Migrator) notify(event *Event) {
+	if m.Observer != nil {
+		m.Observer.Observe(event)
+	}
+}
@@ -0,0 +1,53 @@
+package dbmigrate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingObserver records observed events
+type recordingObserver struct {
+	events []*Event
+}
+
+func (o *recordingObserver) Observe(event *Event) {
+	o.events = append(o.events, event)
+}
+
+// types returns types of recorded events
+func (o *recordingObserver) types() []EventType {
+	var types []EventType
+	for _, event := range o.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// recordingLogger records logged statements
+type recordingLogger struct {
+	statements []*Statement
+}
+
+func (l *recordingLogger) LogStatement(migration *Migration, statement *Statement, duration time.Duration, rowsAffected int64) {
+	l.statements = append(l.statements, statement)
+}
+
+func Test_EventType_String(t *testing.T) {
+	assert.Equal(t, "migration finished", EventMigrationFinished.String())
+	assert.Equal(t, "warning", EventWarning.String())
+	assert.Equal(t, "unknown", eventTypeError.String())
+}
+
+func Test_ObserverFunc(t *testing.T) {
+	var observed *Event
+	m := &Migrator{Settings: &Settings{Observer: ObserverFunc(func(event *Event) { observed = event })}}
+	event := &Event{Type: EventMigrationStarted}
+	m.notify(event)
+	assert.Equal(t, event, observed)
+
+	// without observer events are just dropped
+	m.Observer = nil
+	m.notify(&Event{Type: EventWarning})
+}
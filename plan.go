@@ -0,0 +1,57 @@
+package dbmigrate
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// Plan describes what migrate or rollback operation would execute
+type Plan struct {
+	Direction Direction
+	// Steps are the migrations in the order they would be run
+	Steps []*PlanStep
+}
+
+// PlanStep holds the migration and the statements which would be executed for it
+type PlanStep struct {
+	Migration *Migration
+	// Transactional is false for migrations with the no-transaction directive
+	Transactional bool
+	// Statements are the statements in the order they would be executed,
+	// the last two change the migrations table and append the history entry.
+	// Empty down migrations, which are skipped if missing downs are allowed, have no statements
+	Statements []string
+}
+
+// Migrations returns the migrations of the plan
+func (p *Plan) Migrations() []*Migration {
+	migrations := make([]*Migration, len(p.Steps))
+	for i, step := range p.Steps {
+		migrations[i] = step.Migration
+	}
+	return migrations
+}
+
+// renderQuery replaces ? placeholders of the query with quoted args, or NULL for nil ones, so it can be shown
+func renderQuery(query string, args ...interface{}) string {
+	var sb strings.Builder
+	for _, arg := range args {
+		i := strings.Index(query, "?")
+		if i < 0 {
+			break
+		}
+		sb.WriteString(query[:i])
+		if valuer, ok := arg.(driver.Valuer); ok {
+			arg, _ = valuer.Value()
+		}
+		if arg == nil {
+			sb.WriteString("NULL")
+		} else {
+			sb.WriteString("'" + strings.Replace(fmt.Sprint(arg), "'", "''", -1) + "'")
+		}
+		query = query[i+1:]
+	}
+	sb.WriteString(query)
+	return sb.String()
+}
@@ -0,0 +1,22 @@
+package dbmigrate
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Plan_Migrations(t *testing.T) {
+	m1, m2 := &Migration{Name: "first"}, &Migration{Name: "second"}
+	plan := &Plan{Steps: []*PlanStep{{Migration: m1}, {Migration: m2}}}
+	assert.Equal(t, []*Migration{m1, m2}, plan.Migrations())
+}
+
+func Test_renderQuery(t *testing.T) {
+	assert.Equal(t, "DELETE FROM migrations WHERE version = '20180918200453'",
+		renderQuery("DELETE FROM migrations WHERE version = ?", "20180918200453"))
+	assert.Equal(t, "INSERT INTO t (a, b) VALUES ('it''s', '1')", renderQuery("INSERT INTO t (a, b) VALUES (?, ?)", "it's", 1))
+	assert.Equal(t, "SELECT 1", renderQuery("SELECT 1"))
+	assert.Equal(t, "INSERT INTO t (a, b) VALUES (NULL, 'b')", renderQuery("INSERT INTO t (a, b) VALUES (?, ?)", nil, sql.NullString{String: "b", Valid: true}))
+}
@@ -1,27 +1,34 @@
 package dbmigrate
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 
 	// postgres driver, imported only to exec init function
 	_ "github.com/lib/pq"
 )
 
 func init() {
-	providers["postgres"] = &postgresProvider{}
+	RegisterProvider("postgres", &postgresProvider{})
 }
 
-// postgresProvider is the provider and placeholdersProvider interfaces implementation for postgres
+// postgresProvider is the Provider, PlaceholdersProvider, TransactionalDDLProvider and SchemaDumpProvider interfaces implementation for postgres
 type postgresProvider struct {
 	defaultProvider
 }
 
-func (p *postgresProvider) driver() string {
+func (p *postgresProvider) Driver() string {
 	return "postgres"
 }
 
-func (p *postgresProvider) dsn(settings *Settings) (string, error) {
+func (p *postgresProvider) DSN(settings *Settings) (string, error) {
 	var kvs []string
 
 	if settings.Database == "" {
@@ -35,7 +42,7 @@ func (p *postgresProvider) dsn(settings *Settings) (string, error) {
 	kvs = append(kvs, "user="+settings.User)
 
 	if settings.Password != "" {
-		kvs = append(kvs, "password="+settings.Password)
+		kvs = append(kvs, "password="+quoteDSNValue(settings.Password))
 	}
 
 	if settings.Host != "" {
@@ -46,12 +53,56 @@ func (p *postgresProvider) dsn(settings *Settings) (string, error) {
 		kvs = append(kvs, fmt.Sprintf("port=%d", settings.Port))
 	}
 
-	kvs = append(kvs, "sslmode=disable")
+	// unqualified names, both in migrations and in dbmigrate queries, refer to the schema
+	if settings.Schema != "" {
+		kvs = append(kvs, "search_path="+settings.Schema)
+	}
+
+	// TLS is disabled by default, params, if they are set, override TLS settings
+	sslMode := settings.SSLMode
+	if sslMode == "" {
+		sslMode = SSLModeDisable
+	}
+	for _, kv := range [][2]string{{"sslmode", sslMode}, {"sslrootcert", settings.SSLCA}, {"sslcert", settings.SSLCert}, {"sslkey", settings.SSLKey}} {
+		if _, ok := settings.Params[kv[0]]; !ok && kv[1] != "" {
+			kvs = append(kvs, kv[0]+"="+quoteDSNValue(kv[1]))
+		}
+	}
+
+	keys := make([]string, 0, len(settings.Params))
+	for k := range settings.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		kvs = append(kvs, k+"="+quoteDSNValue(settings.Params[k]))
+	}
 
 	return strings.Join(kvs, " "), nil
 }
 
-func (p *postgresProvider) setPlaceholders(s string) string {
+// quoteDSNValue quotes the value of key=value connection string pair if it is empty or contains spaces or quotes
+func quoteDSNValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(v) + "'"
+}
+
+func (p *postgresProvider) SerialPrimaryKeyType() string {
+	return "SERIAL PRIMARY KEY"
+}
+
+func (p *postgresProvider) HasTableQuery() string {
+	// tables with the same name can exist in other schemas, current_schema() is the configured schema if it is set
+	return "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+}
+
+func (p *postgresProvider) SplitStatements(query string) ([]*Statement, error) {
+	return SplitStatements(query, &SQLDialect{EscapeStrings: true, DollarQuotes: true, NestedComments: true})
+}
+
+func (p *postgresProvider) SetPlaceholders(s string) string {
 	// for postgres, variable placeholders not question marks but $1, $2, $2, etc
 	counter := 0
 	for strings.Contains(s, "?") {
@@ -60,3 +111,158 @@ func (p *postgresProvider) setPlaceholders(s string) string {
 	}
 	return s
 }
+
+func (p *postgresProvider) TransactionalDDL() bool {
+	return true
+}
+
+func (p *postgresProvider) DumpSchema(ctx context.Context, db *sql.DB, excluded []string) ([]string, error) {
+	var tables []string
+	definitions := make(map[string][]string)
+
+	rows, err := db.QueryContext(ctx, "SELECT c.table_name, c.column_name, c.data_type, c.udt_name, c.character_maximum_length, "+
+		"c.numeric_precision, c.numeric_scale, c.is_nullable, c.column_default FROM information_schema.columns c "+
+		"JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name "+
+		"WHERE c.table_schema = current_schema() AND t.table_type = 'BASE TABLE' ORDER BY c.table_name, c.ordinal_position")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't select columns")
+	}
+	for rows.Next() {
+		var table string
+		col := &postgresColumn{}
+		err = rows.Scan(&table, &col.name, &col.dataType, &col.udtName, &col.length, &col.precision, &col.scale, &col.nullable, &col.def)
+		if err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "can't scan column")
+		}
+		if isExcluded(table, excluded) {
+			continue
+		}
+		if _, ok := definitions[table]; !ok {
+			tables = append(tables, table)
+		}
+		definitions[table] = append(definitions[table], col.definition())
+	}
+	rows.Close()
+
+	// information_schema has no definitions of check and foreign key constraints, so they are taken from pg_catalog
+	constraints := make(map[string]bool)
+	rows, err = db.QueryContext(ctx, "SELECT cl.relname, c.conname, pg_get_constraintdef(c.oid) FROM pg_constraint c "+
+		"JOIN pg_class cl ON cl.oid = c.conrelid JOIN pg_namespace n ON n.oid = cl.relnamespace "+
+		"WHERE n.nspname = current_schema() ORDER BY cl.relname, c.contype, c.conname")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't select constraints")
+	}
+	for rows.Next() {
+		var table, name, definition string
+		err = rows.Scan(&table, &name, &definition)
+		if err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "can't scan constraint")
+		}
+		if _, ok := definitions[table]; ok {
+			definitions[table] = append(definitions[table], fmt.Sprintf("CONSTRAINT %s %s", name, definition))
+			constraints[name] = true
+		}
+	}
+	rows.Close()
+
+	var statements []string
+	for _, table := range tables {
+		statements = append(statements, fmt.Sprintf("CREATE TABLE %s (\n    %s\n)", table, strings.Join(definitions[table], ",\n    ")))
+	}
+
+	// indexes backing primary key and unique constraints are created by the constraints
+	rows, err = db.QueryContext(ctx, "SELECT tablename, indexname, indexdef FROM pg_indexes WHERE schemaname = current_schema() ORDER BY tablename, indexname")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't select indexes")
+	}
+	for rows.Next() {
+		var table, name, definition string
+		err = rows.Scan(&table, &name, &definition)
+		if err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "can't scan index")
+		}
+		if _, ok := definitions[table]; ok && !constraints[name] {
+			statements = append(statements, definition)
+		}
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, "SELECT table_name, view_definition FROM information_schema.views WHERE table_schema = current_schema() ORDER BY table_name")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't select views")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var definition sql.NullString
+		err = rows.Scan(&name, &definition)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan view")
+		}
+		if !isExcluded(name, excluded) {
+			statements = append(statements, fmt.Sprintf("CREATE VIEW %s AS\n%s", name, strings.TrimSpace(definition.String)))
+		}
+	}
+	return statements, rows.Err()
+}
+
+// postgresColumn holds the column data from information_schema.columns
+type postgresColumn struct {
+	name      string
+	dataType  string
+	udtName   string
+	length    sql.NullInt64
+	precision sql.NullInt64
+	scale     sql.NullInt64
+	nullable  string
+	def       sql.NullString
+}
+
+// definition returns the column definition used in CREATE TABLE statement
+func (c *postgresColumn) definition() string {
+	typ := c.dataType
+	switch {
+	case c.dataType == "USER-DEFINED":
+		typ = c.udtName
+	case c.dataType == "ARRAY":
+		// udt names of array types are names of their element types prefixed with underscore
+		typ = strings.TrimPrefix(c.udtName, "_") + "[]"
+	case c.length.Valid:
+		typ = fmt.Sprintf("%s(%d)", c.dataType, c.length.Int64)
+	case c.dataType == "numeric" && c.precision.Valid:
+		typ = fmt.Sprintf("numeric(%d,%d)", c.precision.Int64, c.scale.Int64)
+	}
+
+	definition := c.name + " " + typ
+	if c.def.Valid {
+		definition += " DEFAULT " + c.def.String
+	}
+	if c.nullable == "NO" {
+		definition += " NOT NULL"
+	}
+	return definition
+}
+
+func (p *postgresProvider) Lock(ctx context.Context, conn *sql.Conn, table string, timeout time.Duration) error {
+	// pg_advisory_lock can't wait with timeout, so try to acquire the lock until it succeeds or timeout expires
+	return PollLock(ctx, timeout, func() (bool, error) {
+		var ok bool
+		err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", p.lockKey(table)).Scan(&ok)
+		return ok, err
+	})
+}
+
+func (p *postgresProvider) Unlock(conn *sql.Conn, table string) error {
+	_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", p.lockKey(table))
+	return err
+}
+
+// lockKey returns advisory lock key for the migrations table, advisory locks are already scoped to the current database
+func (p *postgresProvider) lockKey(table string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("dbmigrate." + table))
+	return int64(h.Sum64())
+}
@@ -12,37 +12,89 @@ func Test_postgresProviderExist(t *testing.T) {
 	assert.True(t, ok)
 }
 
-func Test_postgresProvider_driver(t *testing.T) {
-	assert.Equal(t, "postgres", (&postgresProvider{}).driver())
+func Test_postgresProvider_Driver(t *testing.T) {
+	assert.Equal(t, "postgres", (&postgresProvider{}).Driver())
 }
 
-func Test_postgresProvider_dsn(t *testing.T) {
+func Test_postgresProvider_DSN(t *testing.T) {
 	p := &postgresProvider{}
 	s := &Settings{}
 
-	_, err := p.dsn(s)
+	_, err := p.DSN(s)
 	assert.EqualError(t, err, errDBNameNotProvided.Error())
 
 	s.Database = "test"
-	_, err = p.dsn(s)
+	_, err = p.DSN(s)
 	assert.EqualError(t, err, errUserNotProvided.Error())
 
 	s.User = "root"
-	dsn, err := p.dsn(s)
+	dsn, err := p.DSN(s)
 	require.NoError(t, err)
 	assert.Equal(t, "dbname=test user=root sslmode=disable", dsn)
 
 	s.Password = "12345"
 	s.Host = "myhost"
 	s.Port = 5555
-	dsn, err = p.dsn(s)
+	dsn, err = p.DSN(s)
 	require.NoError(t, err)
 	assert.Equal(t, "dbname=test user=root password=12345 host=myhost port=5555 sslmode=disable", dsn)
+
+	s.Schema = "meta"
+	dsn, err = p.DSN(s)
+	require.NoError(t, err)
+	assert.Equal(t, "dbname=test user=root password=12345 host=myhost port=5555 search_path=meta sslmode=disable", dsn)
+
+	s.Schema = ""
+	s.Password = "it's secret"
+	s.Params = map[string]string{"sslmode": "require", "connect_timeout": "10", "application_name": ""}
+	dsn, err = p.DSN(s)
+	require.NoError(t, err)
+	assert.Equal(t, `dbname=test user=root password='it\'s secret' host=myhost port=5555 application_name='' connect_timeout=10 sslmode=require`, dsn)
+
+	s.Password = ""
+	s.Params = map[string]string{"sslkey": "/certs/other.key"}
+	s.SSLMode, s.SSLCA, s.SSLCert, s.SSLKey = SSLModeVerifyFull, "/certs/ca.pem", "/certs/client.crt", "/certs/client.key"
+	dsn, err = p.DSN(s)
+	require.NoError(t, err)
+	assert.Equal(t, "dbname=test user=root host=myhost port=5555 sslmode=verify-full sslrootcert=/certs/ca.pem sslcert=/certs/client.crt "+
+		"sslkey=/certs/other.key", dsn)
+}
+
+func Test_postgresProvider_HasTableQuery(t *testing.T) {
+	assert.Contains(t, (&postgresProvider{}).HasTableQuery(), "table_schema = current_schema()")
 }
 
-func Test_postgresProvider_setPlaceholders(t *testing.T) {
+func Test_postgresProvider_SetPlaceholders(t *testing.T) {
 	p := &postgresProvider{}
 	s := "SELECT * FROM posts WHERE author_id = ? AND created_AT > ? LIMIT 10 ORDER BY created_at ?"
 	expected := "SELECT * FROM posts WHERE author_id = $1 AND created_AT > $2 LIMIT 10 ORDER BY created_at $3"
-	assert.Equal(t, expected, p.setPlaceholders(s))
+	assert.Equal(t, expected, p.SetPlaceholders(s))
+}
+
+func Test_postgresProvider_SplitStatements(t *testing.T) {
+	p := &postgresProvider{}
+
+	query := `CREATE FUNCTION inc(i integer) RETURNS integer AS $$
+BEGIN
+	RETURN i + 1;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION dec(i integer) RETURNS integer AS $body$ BEGIN RETURN i - 1; END; $body$ LANGUAGE plpgsql;
+/* nested /* comment; */ still comment; */
+INSERT INTO posts (title) VALUES (E'it\'s; escaped'), ($1);
+CREATE FUNCTION one() RETURNS integer LANGUAGE SQL BEGIN ATOMIC SELECT 1; END;`
+	statements, err := p.SplitStatements(query)
+	require.NoError(t, err)
+	require.Len(t, statements, 4)
+	assert.Contains(t, statements[0].Query, "RETURN i + 1;")
+	assert.Equal(t, 1, statements[0].Line)
+	assert.Contains(t, statements[1].Query, "RETURN i - 1;")
+	assert.Equal(t, 7, statements[1].Line)
+	assert.Equal(t, `INSERT INTO posts (title) VALUES (E'it\'s; escaped'), ($1)`, statements[2].Query)
+	assert.Equal(t, 9, statements[2].Line)
+	assert.Equal(t, "CREATE FUNCTION one() RETURNS integer LANGUAGE SQL BEGIN ATOMIC SELECT 1; END", statements[3].Query)
+
+	_, err = p.SplitStatements("CREATE FUNCTION f() AS $$ BEGIN;")
+	assert.EqualError(t, err, "line 1: unterminated dollar quoted string")
 }
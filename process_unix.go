@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package dbmigrate
+
+import "syscall"
+
+// processExists checks if the process with the given pid is running,
+// signal 0 is not sent, but the existence of the process is checked
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
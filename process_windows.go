@@ -0,0 +1,14 @@
+package dbmigrate
+
+import "os"
+
+// processExists checks if the process with the given pid is running,
+// on windows FindProcess fails if there is no such process
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
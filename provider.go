@@ -1,27 +1,118 @@
 package dbmigrate
 
-// providers is the map where keys are database engines names and values are implementations of provider inerface
-var providers = make(map[string]provider)
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
 
-// provider is the interface for database engines specific stuff
-type provider interface {
-	// driver returns driver name string by the database/sql lib to connect to database
-	driver() string
-	// dsn returns database connection string
-	dsn(settings *Settings) (string, error)
-	// hasTableQuery returns SQL query to check if the table used to store migrations exists
-	hasTableQuery() string
+	"github.com/pkg/errors"
+)
+
+// providers is the map where keys are database engines names and values are implementations of Provider interface
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]Provider)
+)
+
+// lockPollInterval is the interval between attempts to acquire the migrations lock for engines without blocking locks
+const lockPollInterval = 100 * time.Millisecond
+
+// Provider is the interface for database engines specific stuff,
+// engines other than postgres, mysql and sqlite can be supported by implementing it and calling RegisterProvider
+type Provider interface {
+	// Driver returns driver name string by the database/sql lib to connect to database
+	Driver() string
+	// DSN returns database connection string
+	DSN(settings *Settings) (string, error)
+	// HasTableQuery returns SQL query, with ? placeholder for the table name, to check if the table exists
+	HasTableQuery() string
+	// Lock acquires the database-level lock for the given migrations table using conn,
+	// waiting for it no longer than timeout or until ctx is cancelled
+	Lock(ctx context.Context, conn *sql.Conn, table string, timeout time.Duration) error
+	// TimestampType returns the type of the column holding native timestamps without time zone
+	TimestampType() string
+	// SerialPrimaryKeyType returns the definition of the auto incremented integer primary key column
+	SerialPrimaryKeyType() string
+	// SplitStatements splits migration into separate statements according to the engine's SQL syntax
+	SplitStatements(query string) ([]*Statement, error)
+	// Unlock releases the lock acquired by Lock using the same conn,
+	// it takes no context because the lock must be released even if the operation was cancelled
+	Unlock(conn *sql.Conn, table string) error
+}
+
+// PlaceholdersProvider is the optional interface of providers whose engines use variables placeholders other than question marks
+type PlaceholdersProvider interface {
+	// SetPlaceholders sets database specific variables placeholders in a SQL string
+	SetPlaceholders(string) string
+}
+
+// TransactionalDDLProvider is the optional interface of providers whose engines can roll back DDL statements executed inside transaction,
+// executed statements of migrations on other engines are tracked, so partially executed ones can be repaired
+type TransactionalDDLProvider interface {
+	// TransactionalDDL returns true if DDL statements are rolled back with the transaction
+	TransactionalDDL() bool
 }
 
-// placeholdersProvider is the interface to set database specific variables placeholders in a SQL string
-type placeholdersProvider interface {
-	// setPlaceholders sets database specific variables placeholders in a SQL string
-	setPlaceholders(string) string
+// RegisterProvider makes the database engine available by the name, which is used as Settings.Engine
+// and as the engine part of engine specific migrations files names.
+// It is intended to be called from init functions and panics if p is nil or the name is already registered
+func RegisterProvider(name string, p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if p == nil {
+		panic("dbmigrate: provider is nil")
+	}
+	if name == "" || name != strings.ToLower(name) {
+		panic("dbmigrate: provider name should be non-empty and lowercased, got " + name)
+	}
+	if _, ok := providers[name]; ok {
+		panic("dbmigrate: provider " + name + " is already registered")
+	}
+	providers[name] = p
 }
 
-// defaultProvider is the default implementation of provider interface
+// providerByName returns the provider registered with the name
+func providerByName(name string) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	p, ok := providers[name]
+	return p, ok
+}
+
+// defaultProvider is the default implementation of some Provider interface methods
 type defaultProvider struct{}
 
-func (p *defaultProvider) hasTableQuery() string {
+func (p *defaultProvider) HasTableQuery() string {
 	return "SELECT table_name FROM information_schema.tables WHERE table_name = ?"
 }
+
+func (p *defaultProvider) TimestampType() string {
+	return "TIMESTAMP"
+}
+
+// PollLock calls tryLock until it succeeds, returns an error, timeout expires or ctx is cancelled,
+// it is used by providers to implement Lock method for engines without locks waiting with timeout
+func PollLock(ctx context.Context, timeout time.Duration, tryLock func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLock()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("lock is held by another process, gave up after %s", timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -4,9 +4,42 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func Test_defaultProvider_hasTableQuery(t *testing.T) {
+func Test_defaultProvider_HasTableQuery(t *testing.T) {
 	p := &defaultProvider{}
-	assert.Contains(t, p.hasTableQuery(), "information_schema.tables")
+	assert.Contains(t, p.HasTableQuery(), "information_schema.tables")
+}
+
+// testProvider is the Provider registered by the test, it uses sqlite under another engine name
+type testProvider struct {
+	sqliteProvider
+}
+
+func Test_RegisterProvider(t *testing.T) {
+	RegisterProvider("testdb", &testProvider{})
+	defer func() {
+		providersMu.Lock()
+		delete(providers, "testdb")
+		providersMu.Unlock()
+	}()
+
+	assert.Equal(t, []string{"mysql", "postgres", "sqlite", "testdb"}, Engines())
+
+	p, ok := providerByName("testdb")
+	require.True(t, ok)
+	assert.Equal(t, "sqlite3", p.Driver())
+
+	m, err := migrationFromFileName("20100607080910.test_migration.up.testdb.sql")
+	require.NoError(t, err)
+	assert.Equal(t, "testdb", m.Engine)
+
+	s := &Settings{URL: "testdb://user@localhost/test"}
+	require.NoError(t, applyURL(s))
+	assert.Equal(t, "testdb", s.Engine)
+
+	assert.Panics(t, func() { RegisterProvider("testdb", &testProvider{}) })
+	assert.Panics(t, func() { RegisterProvider("other", nil) })
+	assert.Panics(t, func() { RegisterProvider("TestDB", &testProvider{}) })
 }
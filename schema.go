@@ -0,0 +1,93 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SchemaDumpProvider is the optional interface of providers which can dump the database schema
+type SchemaDumpProvider interface {
+	// DumpSchema returns statements creating tables, except the excluded ones, their indexes and other objects of the current schema.
+	// Statements must be sorted, so the dump doesn't change unless the schema does
+	DumpSchema(ctx context.Context, db *sql.DB, excluded []string) ([]string, error)
+}
+
+// SchemaFileName returns the name of the file the schema of the database of the engine is dumped to
+func SchemaFileName(engine string) string {
+	return "schema." + engine + ".sql"
+}
+
+// DumpSchema writes the schema of the database and versions of applied migrations to the schema.<engine>.sql file
+// in the directory migrations are read from, so changes of the schema made by migrations can be seen in diffs.
+// It returns the file path and fails if migrations are not read from the directory, e.g. from the archive or embedded files
+func (m *Migrator) DumpSchema() (string, error) {
+	return m.DumpSchemaContext(context.Background())
+}
+
+// DumpSchemaContext is the same as DumpSchema, but it can be cancelled using ctx
+func (m *Migrator) DumpSchemaContext(ctx context.Context) (string, error) {
+	dump, err := m.schemaDump(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	ds, ok := m.MigrationsSource.(*dirSource)
+	if !ok {
+		return "", errors.New("can't dump schema, migrations are not read from the directory")
+	}
+
+	fpath := filepath.Join(ds.dir, SchemaFileName(m.Engine))
+	err = ioutil.WriteFile(fpath, dump, 0644)
+	if err != nil {
+		return "", errors.Wrapf(err, "can't write schema to %s", fpath)
+	}
+	return fpath, nil
+}
+
+// schemaDump returns the schema dump, the migrations table is dumped with versions of applied migrations,
+// other dbmigrate tables, which rows are changed by every operation, are skipped
+func (m *Migrator) schemaDump(ctx context.Context) ([]byte, error) {
+	sdp, ok := m.dbWrapper.provider.(SchemaDumpProvider)
+	if !ok {
+		return nil, errors.Errorf("can't dump schema, %s engine doesn't support it", m.Engine)
+	}
+
+	// the lock table is used by engines without named locks, e.g. sqlite
+	excluded := []string{m.MigrationsTable + "_history", m.MigrationsTable + "_version", m.MigrationsTable + "_dirty", m.MigrationsTable + "_lock"}
+	statements, err := sdp.DumpSchema(ctx, m.dbWrapper.db, excluded)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't dump schema")
+	}
+
+	appliedMigrationsData, err := m.dbWrapper.appliedMigrationsData(ctx, "version ASC")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't dump schema")
+	}
+
+	var b bytes.Buffer
+	b.WriteString("-- Schema of the database, generated by dbmigrate, do not edit this file manually\n\n")
+	for _, st := range statements {
+		b.WriteString(strings.TrimSuffix(strings.TrimSpace(st), ";") + ";\n\n")
+	}
+	for _, md := range appliedMigrationsData {
+		fmt.Fprintf(&b, "INSERT INTO %s (version) VALUES ('%s');\n", m.MigrationsTable, md.version.Format(TimestampFormat))
+	}
+	return b.Bytes(), nil
+}
+
+// isExcluded returns true if the table is one of the excluded ones, which are not dumped
+func isExcluded(table string, excluded []string) bool {
+	for _, t := range excluded {
+		if strings.EqualFold(t, table) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package dbmigrate
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Migrator_DumpSchema(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db"})
+	defer m.Close()
+
+	m.MigrateSteps(2)
+	fpath, err := m.DumpSchema()
+	require.NoError(t, err)
+	defer os.Remove(fpath)
+	wd, _ := os.Getwd()
+	assert.Equal(t, filepath.Join(wd, MigrationsDir, "schema.sqlite.sql"), fpath)
+
+	dump, _ := ioutil.ReadFile(fpath)
+	assert.Contains(t, string(dump), "CREATE TABLE posts (title VARCHAR NOT NULL, content TEXT NOT NULL, PRIMARY KEY(title));\n")
+	assert.Contains(t, string(dump), "INSERT INTO migrations (version) VALUES ('20180918200453');\nINSERT INTO migrations (version) VALUES ('20180918200632');\n")
+	assert.NotContains(t, string(dump), "migrations_history")
+
+	// the schema file is not a migration
+	migrations, err := m.findMigrations(DirectionUp)
+	require.NoError(t, err)
+	for _, migration := range migrations {
+		assert.NotEqual(t, "schema", migration.Name)
+	}
+
+	// the dump doesn't change unless the schema does
+	_, err = m.DumpSchema()
+	require.NoError(t, err)
+	sameDump, _ := ioutil.ReadFile(fpath)
+	assert.Equal(t, dump, sameDump)
+
+	m.Rollback()
+	_, err = m.DumpSchema()
+	require.NoError(t, err)
+	dump, _ = ioutil.ReadFile(fpath)
+	assert.NotContains(t, string(dump), "20180918200453")
+}
+
+func Test_Migrator_DumpSchema_source(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	// the schema is written to the directory migrations are read from, rather than to the working one
+	dir, _ := ioutil.TempDir("", "dbmigrate")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "20180918200453.posts.up.sql"), []byte("CREATE TABLE posts (title VARCHAR NOT NULL);"), 0644)
+
+	m, _ := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db", MigrationsSource: DirSource(dir)})
+	m.Migrate()
+	fpath, err := m.DumpSchema()
+	m.Close()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "schema.sqlite.sql"), fpath)
+	assert.True(t, FileExists(fpath))
+
+	m, _ = NewMigrator(&Settings{Engine: "sqlite", Database: "test.db", MigrationsSource: &archiveSource{files: map[string][]byte{}}})
+	defer m.Close()
+	_, err = m.DumpSchema()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "migrations are not read from the directory")
+}
+
+func Test_postgresColumn_definition(t *testing.T) {
+	for _, tc := range []struct {
+		col      *postgresColumn
+		expected string
+	}{
+		{&postgresColumn{name: "title", dataType: "character varying", length: sql.NullInt64{Int64: 255, Valid: true}, nullable: "NO"},
+			"title character varying(255) NOT NULL"},
+		{&postgresColumn{name: "id", dataType: "integer", nullable: "NO", def: sql.NullString{String: "nextval('posts_id_seq'::regclass)", Valid: true}},
+			"id integer DEFAULT nextval('posts_id_seq'::regclass) NOT NULL"},
+		{&postgresColumn{name: "price", dataType: "numeric", precision: sql.NullInt64{Int64: 10, Valid: true}, scale: sql.NullInt64{Int64: 2, Valid: true}, nullable: "YES"},
+			"price numeric(10,2)"},
+		{&postgresColumn{name: "tags", dataType: "ARRAY", udtName: "_text", nullable: "YES"}, "tags text[]"},
+		{&postgresColumn{name: "mood", dataType: "USER-DEFINED", udtName: "mood", nullable: "YES"}, "mood mood"},
+	} {
+		assert.Equal(t, tc.expected, tc.col.definition())
+	}
+}
+
+func Test_mysqlProvider_normalizeCreateStatement(t *testing.T) {
+	p := &mysqlProvider{}
+	assert.Equal(t, "CREATE TABLE `posts` (\n  `id` int NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		p.normalizeCreateStatement("CREATE TABLE `posts` (\n  `id` int NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB AUTO_INCREMENT=42 DEFAULT CHARSET=utf8mb4"))
+	assert.Equal(t, "CREATE ALGORITHM=UNDEFINED SQL SECURITY DEFINER VIEW `titles` AS select `posts`.`title` AS `title` from `posts`",
+		p.normalizeCreateStatement("CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`%` SQL SECURITY DEFINER VIEW `titles` AS select `posts`.`title` AS `title` from `posts`"))
+}
@@ -0,0 +1,193 @@
+package dbmigrate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MigrationSource provides migrations files, e.g. from the directory, embedded file system or archive
+type MigrationSource interface {
+	// FileNames returns names of the files in the root of the source, files in subdirectories are ignored
+	FileNames() ([]string, error)
+	// ReadFile returns contents of the file with the given name
+	ReadFile(name string) ([]byte, error)
+}
+
+// dirSource reads migrations from the directory
+type dirSource struct {
+	dir string
+}
+
+// DirSource returns the source which reads migrations from the directory at the given path
+func DirSource(dir string) MigrationSource {
+	return &dirSource{dir: dir}
+}
+
+func (s *dirSource) FileNames() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read directory %s", s.dir)
+	}
+
+	var names []string
+	for _, info := range infos {
+		if !info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *dirSource) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.dir, name))
+}
+
+// archiveSource holds migrations read from the archive in memory
+type archiveSource struct {
+	files map[string][]byte
+}
+
+// ArchiveSource reads migrations from the zip or tar (optionally gzipped) archive at the given path.
+// Migrations should be either in the root of the archive or in the dbmigrations dir in its root
+func ArchiveSource(fpath string) (MigrationSource, error) {
+	s := &archiveSource{files: map[string][]byte{}}
+
+	lpath := strings.ToLower(fpath)
+	var err error
+	switch {
+	case strings.HasSuffix(lpath, ".zip"):
+		err = s.readZip(fpath)
+	case strings.HasSuffix(lpath, ".tar"):
+		err = s.readTar(fpath, false)
+	case strings.HasSuffix(lpath, ".tar.gz"), strings.HasSuffix(lpath, ".tgz"):
+		err = s.readTar(fpath, true)
+	default:
+		return nil, errors.Errorf("unsupported archive format of %s, should be zip, tar, tar.gz or tgz", fpath)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read archive %s", fpath)
+	}
+
+	return s, nil
+}
+
+func (s *archiveSource) FileNames() ([]string, error) {
+	var names []string
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *archiveSource) ReadFile(name string) ([]byte, error) {
+	data, ok := s.files[name]
+	if !ok {
+		return nil, errors.Errorf("file %s does not exist in archive", name)
+	}
+	return data, nil
+}
+
+// readZip reads migrations from the zip archive
+func (s *archiveSource) readZip(fpath string) error {
+	r, err := zip.OpenReader(fpath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		name, ok := archiveFileName(f.Name)
+		if !ok || f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return errors.Wrapf(err, "can't open %s", f.Name)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return errors.Wrapf(err, "can't read %s", f.Name)
+		}
+		err = s.addFile(name, f.Name, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTar reads migrations from the tar archive, which is optionally gzipped
+func (s *archiveSource) readTar(fpath string, gzipped bool) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if gzipped {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name, ok := archiveFileName(header.Name)
+		if !ok || header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return errors.Wrapf(err, "can't read %s", header.Name)
+		}
+		err = s.addFile(name, header.Name, data)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// addFile adds the migration file, it is an error if the archive has files with the same name
+// both in the root and in the dbmigrations dir, because it is unclear which one should be used
+func (s *archiveSource) addFile(name, archivedName string, data []byte) error {
+	if _, ok := s.files[name]; ok {
+		return errors.Errorf("duplicated migration file %s in archive, found as %s", name, archivedName)
+	}
+	s.files[name] = data
+	return nil
+}
+
+// archiveFileName returns the name of the archived file if it is in the root of the archive or in the dbmigrations dir
+func archiveFileName(name string) (string, bool) {
+	dir, fname := path.Split(path.Clean(strings.TrimPrefix(name, "./")))
+	if dir != "" && dir != MigrationsDir+"/" {
+		return "", false
+	}
+	return fname, true
+}
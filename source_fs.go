@@ -0,0 +1,42 @@
+//go:build go1.16
+// +build go1.16
+
+package dbmigrate
+
+import (
+	"io/fs"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// fsSource reads migrations from the directory of the file system
+type fsSource struct {
+	fsys fs.FS
+	dir  string
+}
+
+// FSSource returns the source which reads migrations from the dir of the file system,
+// e.g. embedded using //go:embed dbmigrations and FSSource(migrationsFS, "dbmigrations")
+func FSSource(fsys fs.FS, dir string) MigrationSource {
+	return &fsSource{fsys: fsys, dir: dir}
+}
+
+func (s *fsSource) FileNames() ([]string, error) {
+	entries, err := fs.ReadDir(s.fsys, s.dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read directory %s", s.dir)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *fsSource) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, path.Join(s.dir, name))
+}
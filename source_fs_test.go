@@ -0,0 +1,33 @@
+//go:build go1.16
+// +build go1.16
+
+package dbmigrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FSSource(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dbmigrations/20180918200453.correct.up.sql":           {Data: []byte("CREATE TABLE posts (title VARCHAR NOT NULL, PRIMARY KEY(title));")},
+		"dbmigrations/20180918200453.correct.down.sql":         {Data: []byte("DROP TABLE posts;")},
+		"dbmigrations/subfolder/20180918200632.other.up.sql":   {Data: []byte("")},
+		"20180918201019.specific_engine_correct.up.sqlite.sql": {Data: []byte("")},
+	}
+
+	s := FSSource(fsys, "dbmigrations")
+	fnames, err := s.FileNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20180918200453.correct.down.sql", "20180918200453.correct.up.sql"}, fnames)
+
+	data, err := s.ReadFile("20180918200453.correct.down.sql")
+	require.NoError(t, err)
+	assert.Equal(t, "DROP TABLE posts;", string(data))
+
+	_, err = FSSource(fsys, "not_exists").FileNames()
+	assert.Error(t, err)
+}
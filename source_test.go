@@ -0,0 +1,135 @@
+package dbmigrate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var archivedFiles = map[string]string{
+	"20180918200453.correct.up.sql":                  "CREATE TABLE posts (title VARCHAR NOT NULL, PRIMARY KEY(title));",
+	"dbmigrations/20180918200453.correct.down.sql":   "DROP TABLE posts;",
+	"./dbmigrations/20180918200632.other.up.sql":     "CREATE TABLE authors (name VARCHAR NOT NULL, PRIMARY KEY(name));",
+	"other/20180918200632.other.down.sql":            "DROP TABLE authors;",
+	"dbmigrations/subfolder/20180918201019.up.sql":   "",
+	"dbmigrations/20180918200632.other.down.sql":     "DROP TABLE authors;",
+	"dbmigrations/nested/dbmigrations/some_file.sql": "",
+}
+
+func writeTar(w io.Writer, files map[string]string) {
+	tw := tar.NewWriter(w)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+}
+
+func createArchives() {
+	writeArchives("test/migrations", archivedFiles)
+}
+
+// writeArchives writes files to tar, tgz and zip archives with the base path
+func writeArchives(base string, files map[string]string) {
+	f, _ := os.Create(base + ".tar")
+	writeTar(f, files)
+	f.Close()
+
+	f, _ = os.Create(base + ".tgz")
+	gw := gzip.NewWriter(f)
+	writeTar(gw, files)
+	gw.Close()
+	f.Close()
+
+	f, _ = os.Create(base + ".zip")
+	zw := zip.NewWriter(f)
+	zw.Create("dbmigrations/")
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	f.Close()
+}
+
+func Test_DirSource(t *testing.T) {
+	s := DirSource(MigrationsDir)
+	fnames, err := s.FileNames()
+	require.NoError(t, err)
+	assert.Contains(t, fnames, "20180918200453.correct.up.sql")
+	assert.NotContains(t, fnames, "subfolder")
+
+	data, err := s.ReadFile("20180918200453.correct.down.sql")
+	require.NoError(t, err)
+	assert.Equal(t, "DROP TABLE posts;", string(data))
+
+	_, err = DirSource("not_exists").FileNames()
+	assert.Error(t, err)
+}
+
+func Test_ArchiveSource(t *testing.T) {
+	createArchives()
+
+	for _, fpath := range []string{"test/migrations.tar", "test/migrations.tgz", "test/migrations.zip"} {
+		s, err := ArchiveSource(fpath)
+		require.NoError(t, err, fpath)
+
+		fnames, err := s.FileNames()
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"20180918200453.correct.down.sql", "20180918200453.correct.up.sql",
+			"20180918200632.other.down.sql", "20180918200632.other.up.sql",
+		}, fnames, fpath)
+
+		data, err := s.ReadFile("20180918200632.other.up.sql")
+		require.NoError(t, err)
+		assert.Equal(t, "CREATE TABLE authors (name VARCHAR NOT NULL, PRIMARY KEY(name));", string(data))
+
+		_, err = s.ReadFile("not_exists.sql")
+		assert.EqualError(t, err, "file not_exists.sql does not exist in archive")
+	}
+
+	_, err := ArchiveSource("test/migrations.rar")
+	assert.EqualError(t, err, "unsupported archive format of test/migrations.rar, should be zip, tar, tar.gz or tgz")
+
+	_, err = ArchiveSource("test/not_exists.zip")
+	assert.Error(t, err)
+}
+
+func Test_ArchiveSource_duplicates(t *testing.T) {
+	writeArchives("test/duplicates", map[string]string{
+		"20180918200453.correct.up.sql":              "CREATE TABLE posts (title VARCHAR NOT NULL, PRIMARY KEY(title));",
+		"dbmigrations/20180918200453.correct.up.sql": "CREATE TABLE authors (name VARCHAR NOT NULL, PRIMARY KEY(name));",
+	})
+
+	for _, fpath := range []string{"test/duplicates.tar", "test/duplicates.tgz", "test/duplicates.zip"} {
+		_, err := ArchiveSource(fpath)
+		require.Error(t, err, fpath)
+		assert.Contains(t, err.Error(), "duplicated migration file 20180918200453.correct.up.sql in archive", fpath)
+	}
+}
+
+func Test_Migrator_ArchiveSource(t *testing.T) {
+	createArchives()
+	defer os.Remove("test.db")
+
+	s, _ := ArchiveSource(filepath.Join("test", "migrations.zip"))
+	m, err := NewMigrator(&Settings{Engine: "sqlite", Database: "test.db", MigrationsSource: s})
+	require.NoError(t, err)
+	defer m.Close()
+
+	n, err := m.Migrate()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = m.Rollback()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
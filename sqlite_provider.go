@@ -1,8 +1,13 @@
 package dbmigrate
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -11,38 +16,187 @@ import (
 )
 
 func init() {
-	providers["sqlite"] = &sqliteProvider{}
+	RegisterProvider("sqlite", &sqliteProvider{})
 }
 
-// sqliteProvider is the provider interface implementation for sqlite
+// sqliteProvider is the Provider, TransactionalDDLProvider and SchemaDumpProvider interfaces implementation for sqlite
 type sqliteProvider struct{}
 
-func (p *sqliteProvider) driver() string {
+func (p *sqliteProvider) Driver() string {
 	return "sqlite3"
 }
 
-func (p *sqliteProvider) dsn(settings *Settings) (string, error) {
+func (p *sqliteProvider) DSN(settings *Settings) (string, error) {
 	if settings.Database == "" {
 		return "", errDBNameNotProvided
 	}
 
+	path, err := p.path(settings)
+	if err != nil {
+		return "", err
+	}
+	if len(settings.Params) == 0 {
+		return path, nil
+	}
+
+	params := url.Values{}
+	for k, v := range settings.Params {
+		params.Set(k, v)
+	}
+	return "file:" + path + "?" + params.Encode(), nil
+}
+
+// path returns the absolute path to the database file, relative paths are relative to the project dir
+func (p *sqliteProvider) path(settings *Settings) (string, error) {
 	if filepath.IsAbs(settings.Database) {
 		return settings.Database, nil
 	}
+	if settings.MigrationsPath != "" {
+		projectDir, err := filepath.Abs(filepath.Dir(settings.MigrationsPath))
+		if err != nil {
+			return "", errors.Wrap(err, "can't get project directory")
+		}
+		return filepath.Join(projectDir, settings.Database), nil
+	}
 
-	// try to find project dir to get the path to the file holding database
+	// try to find project dir to get the path to the file holding database,
+	// there is no project dir if migrations are read from embedded files or archive, so the working dir is used then
 	wd, err := os.Getwd()
 	if err != nil {
 		return "", errors.Wrap(err, "can't get working directory")
 	}
 	projectDir, err := FindProjectDir(wd)
 	if err != nil {
-		return "", err
+		projectDir = wd
 	}
 
 	return filepath.Join(projectDir, settings.Database), nil
 }
 
-func (p *sqliteProvider) hasTableQuery() string {
+func (p *sqliteProvider) HasTableQuery() string {
 	return "SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?"
 }
+
+func (p *sqliteProvider) TimestampType() string {
+	// sqlite has no date types, but the driver returns values of DATETIME columns as time.Time
+	return "DATETIME"
+}
+
+func (p *sqliteProvider) SerialPrimaryKeyType() string {
+	// AUTOINCREMENT prevents reuse of ids of deleted rows
+	return "INTEGER PRIMARY KEY AUTOINCREMENT"
+}
+
+func (p *sqliteProvider) SplitStatements(query string) ([]*Statement, error) {
+	return SplitStatements(query, &SQLDialect{BracketIdentifiers: true})
+}
+
+func (p *sqliteProvider) TransactionalDDL() bool {
+	return true
+}
+
+func (p *sqliteProvider) DumpSchema(ctx context.Context, db *sql.DB, excluded []string) ([]string, error) {
+	// sqlite keeps statements creating objects as they were written, tables are created before their indexes, views and triggers
+	rows, err := db.QueryContext(ctx, "SELECT tbl_name, sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' "+
+		"ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'index' THEN 1 WHEN 'view' THEN 2 ELSE 3 END, name")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't select objects from sqlite_master")
+	}
+	defer rows.Close()
+
+	var statements []string
+	for rows.Next() {
+		var table, statement string
+		err = rows.Scan(&table, &statement)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan sqlite_master row")
+		}
+		if !isExcluded(table, excluded) {
+			statements = append(statements, statement)
+		}
+	}
+	return statements, rows.Err()
+}
+
+func (p *sqliteProvider) Lock(ctx context.Context, conn *sql.Conn, table string, timeout time.Duration) error {
+	// sqlite has no named locks, so the lock is a row in the separate table which exists only while the lock is held,
+	// the row holds pid and host of the holder, so the lock left by the crashed process can be taken over
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INTEGER NOT NULL, locked_at VARCHAR(14) NOT NULL, "+
+		"pid INTEGER NOT NULL, host VARCHAR(255) NOT NULL, PRIMARY KEY(id));", p.lockTable(table)))
+	if err != nil {
+		return err
+	}
+
+	insertLockRow := func() (bool, error) {
+		result, err := conn.ExecContext(ctx, fmt.Sprintf("INSERT OR IGNORE INTO %s (id, locked_at, pid, host) VALUES (1, ?, ?, ?)", p.lockTable(table)),
+			time.Now().UTC().Format(TimestampFormat), os.Getpid(), currentHost())
+		if err != nil {
+			return false, err
+		}
+		n, err := result.RowsAffected()
+		return n == 1, err
+	}
+	err = PollLock(ctx, timeout, func() (bool, error) {
+		ok, err := insertLockRow()
+		if err != nil || ok {
+			return ok, err
+		}
+		released, err := p.releaseStaleLock(ctx, conn, table, timeout)
+		if err != nil || !released {
+			return false, err
+		}
+		return insertLockRow()
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't lock using the %s table", p.lockTable(table))
+	}
+	return nil
+}
+
+// releaseStaleLock deletes the lock row if its holder has crashed, i.e. the holder process on the same host is not running,
+// or the lock held by the process on another host is older than the lock timeout, but not younger than DefaultLockTimeout.
+// It returns true if the lock row has been deleted
+func (p *sqliteProvider) releaseStaleLock(ctx context.Context, conn *sql.Conn, table string, timeout time.Duration) (bool, error) {
+	var lockedAt, host string
+	var pid int
+	err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT locked_at, pid, host FROM %s WHERE id = 1", p.lockTable(table))).Scan(&lockedAt, &pid, &host)
+	if err == sql.ErrNoRows {
+		// the lock has just been released
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if host == currentHost() {
+		if processExists(pid) {
+			return false, nil
+		}
+	} else {
+		if timeout < DefaultLockTimeout {
+			timeout = DefaultLockTimeout
+		}
+		t, err := time.Parse(TimestampFormat, lockedAt)
+		if err == nil && time.Since(t) < timeout {
+			return false, nil
+		}
+	}
+
+	result, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = 1 AND locked_at = ? AND pid = ? AND host = ?", p.lockTable(table)),
+		lockedAt, pid, host)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (p *sqliteProvider) Unlock(conn *sql.Conn, table string) error {
+	_, err := conn.ExecContext(context.Background(), fmt.Sprintf("DELETE FROM %s", p.lockTable(table)))
+	return err
+}
+
+// lockTable returns name of the table holding the lock row for the migrations table
+func (p *sqliteProvider) lockTable(table string) string {
+	return table + "_lock"
+}
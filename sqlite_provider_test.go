@@ -1,11 +1,15 @@
 package dbmigrate
 
 import (
+	"context"
+	"database/sql"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_sqliteProviderExist(t *testing.T) {
@@ -13,28 +17,31 @@ func Test_sqliteProviderExist(t *testing.T) {
 	assert.True(t, ok)
 }
 
-func Test_sqliteProvider_driver(t *testing.T) {
-	assert.Equal(t, "sqlite3", (&sqliteProvider{}).driver())
+func Test_sqliteProvider_Driver(t *testing.T) {
+	assert.Equal(t, "sqlite3", (&sqliteProvider{}).Driver())
 }
 
-func Test_sqliteProvider_dsn(t *testing.T) {
+func Test_sqliteProvider_DSN(t *testing.T) {
 	p := &sqliteProvider{}
 	s := &Settings{}
 
-	_, err := p.dsn(s)
+	_, err := p.DSN(s)
 	assert.EqualError(t, err, errDBNameNotProvided.Error())
 
+	// without project dir the database path is relative to the working dir
 	os.Rename(MigrationsDir, "!"+MigrationsDir)
 	s.Database = "test.db"
-	_, err = p.dsn(s)
-	assert.Error(t, err)
+	dsn, err := p.DSN(s)
+	require.NoError(t, err)
+	cwd, _ := os.Getwd()
+	assert.Equal(t, filepath.Join(cwd, "test.db"), dsn)
 
 	os.Rename("!"+MigrationsDir, MigrationsDir)
 
 	// from project root dir
 	for i, dir := range []string{"/some/absolute/path", ".", "..", "test"} {
 		s.Database = filepath.Join(dir, "test.db")
-		dsn, err := p.dsn(s)
+		dsn, err := p.DSN(s)
 		assert.NoError(t, err)
 		wd, _ := os.Getwd()
 		if i == 0 {
@@ -50,21 +57,94 @@ func Test_sqliteProvider_dsn(t *testing.T) {
 
 	for _, dir := range []string{".", "..", "test"} {
 		s.Database = filepath.Join(dir, "test.db")
-		dsn, err := p.dsn(s)
+		dsn, err := p.DSN(s)
 		assert.NoError(t, err)
 		wd, _ := os.Getwd()
 		assert.Equal(t, filepath.Join(wd, "..", dir, "test.db"), dsn)
 	}
 
 	s.Database = "/some/absolute/path/test.db"
-	dsn, err := p.dsn(s)
+	dsn, err = p.DSN(s)
 	assert.NoError(t, err)
 	assert.Equal(t, "/some/absolute/path/test.db", dsn)
 
+	s.Params = map[string]string{"_busy_timeout": "5000"}
+	dsn, err = p.DSN(s)
+	assert.NoError(t, err)
+	assert.Equal(t, "file:/some/absolute/path/test.db?_busy_timeout=5000", dsn)
+
 	os.Chdir(wd)
 }
 
-func Test_sqliteProvider_hasTableQuery(t *testing.T) {
+func Test_sqliteProvider_HasTableQuery(t *testing.T) {
 	p := &sqliteProvider{}
-	assert.Contains(t, p.hasTableQuery(), "sqlite")
+	assert.Contains(t, p.HasTableQuery(), "sqlite")
+}
+
+func Test_sqliteProvider_Lock(t *testing.T) {
+	os.Remove("test.db")
+	defer os.Remove("test.db")
+
+	p := &sqliteProvider{}
+	db, err := sql.Open(p.Driver(), "test.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conn1, _ := db.Conn(context.Background())
+	defer conn1.Close()
+	conn2, _ := db.Conn(context.Background())
+	defer conn2.Close()
+
+	err = p.Lock(context.Background(), conn1, "migrations", time.Second)
+	require.NoError(t, err)
+
+	// the lock is held by the first connection
+	err = p.Lock(context.Background(), conn2, "migrations", 200*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "lock is held by another process")
+
+	err = p.Unlock(conn1, "migrations")
+	require.NoError(t, err)
+
+	err = p.Lock(context.Background(), conn2, "migrations", time.Second)
+	require.NoError(t, err)
+	err = p.Unlock(conn2, "migrations")
+	require.NoError(t, err)
+
+	// the lock of the crashed process on the same host is taken over at once
+	_, err = db.Exec("INSERT INTO migrations_lock (id, locked_at, pid, host) VALUES (1, ?, ?, ?)", time.Now().UTC().Format(TimestampFormat), 99999999, currentHost())
+	require.NoError(t, err)
+	err = p.Lock(context.Background(), conn1, "migrations", 0)
+	require.NoError(t, err)
+	require.NoError(t, p.Unlock(conn1, "migrations"))
+
+	// the lock of the process on another host is stale only if it is older than the lock timeout
+	_, err = db.Exec("INSERT INTO migrations_lock (id, locked_at, pid, host) VALUES (1, ?, ?, ?)", time.Now().UTC().Format(TimestampFormat), 1, "other")
+	require.NoError(t, err)
+	err = p.Lock(context.Background(), conn1, "migrations", 200*time.Millisecond)
+	require.Error(t, err)
+	_, err = db.Exec("UPDATE migrations_lock SET locked_at = ?", time.Now().UTC().Add(-2*DefaultLockTimeout).Format(TimestampFormat))
+	require.NoError(t, err)
+	err = p.Lock(context.Background(), conn1, "migrations", 0)
+	require.NoError(t, err)
+	require.NoError(t, p.Unlock(conn1, "migrations"))
+}
+
+func Test_sqliteProvider_SplitStatements(t *testing.T) {
+	p := &sqliteProvider{}
+
+	query := `CREATE TABLE [posts;] (title TEXT);
+CREATE TRIGGER posts_ai AFTER INSERT ON posts
+BEGIN
+	INSERT INTO log (msg) VALUES ('inserted;');
+	UPDATE counters SET n = CASE WHEN n IS NULL THEN 1 ELSE n + 1 END;
+END;
+DROP TABLE log;`
+	statements, err := p.SplitStatements(query)
+	require.NoError(t, err)
+	require.Len(t, statements, 3)
+	assert.Equal(t, "CREATE TABLE [posts;] (title TEXT)", statements[0].Query)
+	assert.Equal(t, 2, statements[1].Line)
+	assert.Contains(t, statements[1].Query, "ELSE n + 1 END;\nEND")
+	assert.Equal(t, &Statement{Query: "DROP TABLE log", Line: 7}, statements[2])
 }
@@ -0,0 +1,296 @@
+package dbmigrate
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// noTransactionDirective is the migration header comment which makes migration run without transaction
+const noTransactionDirective = "dbmigrate:no-transaction"
+
+// Statement is the single SQL statement of the migration
+type Statement struct {
+	Query string
+	// Line is the number of the migration file line the statement starts at
+	Line int
+}
+
+// SQLDialect describes database engine specific lexical rules used to split migration into statements,
+// it is used by providers to implement SplitStatements method
+type SQLDialect struct {
+	// BackslashEscapes specifies if backslash escapes characters in single and double quoted strings (mysql)
+	BackslashEscapes bool
+	// EscapeStrings specifies if backslash escapes characters in E'...' strings (postgres)
+	EscapeStrings bool
+	// DollarQuotes specifies if $tag$...$tag$ strings, used for function bodies, are supported (postgres)
+	DollarQuotes bool
+	// NestedComments specifies if block comments can be nested (postgres)
+	NestedComments bool
+	// HashComments specifies if # starts a line comment (mysql)
+	HashComments bool
+	// DashCommentsNeedSpace specifies if -- starts a line comment only when followed by whitespace (mysql)
+	DashCommentsNeedSpace bool
+	// ExecutableComments specifies if /*! ... */ comments are executed, so they can't be stripped (mysql)
+	ExecutableComments bool
+	// BracketIdentifiers specifies if identifiers can be quoted using square brackets (sqlite)
+	BracketIdentifiers bool
+}
+
+// SplitStatements splits migration into separate statements, because mysql driver can't exec multiple statements
+// using one Exec call. Semicolons inside quotes, comments, dollar quoted strings and compound statements
+// such as BEGIN ... END trigger bodies do not end statements. Comments preceding statements are stripped
+func SplitStatements(query string, d *SQLDialect) ([]*Statement, error) {
+	var statements []*Statement
+
+	// start is the index of the current statement's first significant character, -1 if there are none yet
+	start, startLine := -1, 0
+	// depth is the nesting level of BEGIN ... END blocks and CASE ... END expressions
+	depth := 0
+	// words is the number of words in the current statement, used to tell transaction start from block start
+	words := 0
+
+	line := 1
+	n := len(query)
+	i := 0
+
+	markStart := func() {
+		if start < 0 {
+			start, startLine = i, line
+		}
+	}
+
+	for i < n {
+		c := query[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case isSpace(c):
+			i++
+		case c == '-' && i+1 < n && query[i+1] == '-' && (!d.DashCommentsNeedSpace || i+2 >= n || isSpace(query[i+2])),
+			c == '#' && d.HashComments:
+			for i < n && query[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < n && query[i+1] == '*':
+			if d.ExecutableComments && i+2 < n && query[i+2] == '!' {
+				markStart()
+			}
+			end, lines, err := skipBlockComment(query, i, d.NestedComments)
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d", line)
+			}
+			i, line = end, line+lines
+		case c == '\'' || c == '"' || c == '`' || (c == '[' && d.BracketIdentifiers):
+			markStart()
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			escapes := (d.BackslashEscapes && (c == '\'' || c == '"')) || (d.EscapeStrings && c == '\'' && isEscapeStringPrefix(query, i))
+			end, lines, err := skipQuoted(query, i, closing, escapes)
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d", line)
+			}
+			i, line = end, line+lines
+		case c == '$' && d.DollarQuotes:
+			markStart()
+			tag, ok := dollarQuoteTag(query, i)
+			if !ok {
+				i++
+				break
+			}
+			end := strings.Index(query[i+len(tag):], tag)
+			if end < 0 {
+				return nil, errors.Errorf("line %d: unterminated dollar quoted string", line)
+			}
+			end += i + 2*len(tag)
+			line += strings.Count(query[i:end], "\n")
+			i = end
+		case c == ';' && depth == 0:
+			if start >= 0 {
+				statements = append(statements, &Statement{Query: strings.TrimSpace(query[start:i]), Line: startLine})
+			}
+			start, words = -1, 0
+			i++
+		case isIdentStart(c):
+			markStart()
+			j := i
+			for j < n && isIdentChar(query[j]) {
+				j++
+			}
+			words++
+
+			switch strings.ToUpper(query[i:j]) {
+			case "BEGIN":
+				// BEGIN which is the first word of the statement starts transaction, not block
+				if words > 1 {
+					depth++
+				}
+			case "CASE":
+				depth++
+			case "END":
+				if depth == 0 {
+					break
+				}
+				// IF, LOOP, WHILE and REPEAT blocks are not counted, so their ENDs are skipped,
+				// END CASE closes the CASE statement, while plain END closes BEGIN block or CASE expression
+				k := j
+				for k < n && isSpace(query[k]) {
+					k++
+				}
+				l := k
+				for l < n && isIdentChar(query[l]) {
+					l++
+				}
+				switch strings.ToUpper(query[k:l]) {
+				case "IF", "LOOP", "WHILE", "REPEAT":
+				case "CASE":
+					depth--
+					line += strings.Count(query[j:l], "\n")
+					j = l
+				default:
+					depth--
+				}
+			}
+			i = j
+		default:
+			markStart()
+			i++
+		}
+	}
+
+	if start >= 0 {
+		statements = append(statements, &Statement{Query: strings.TrimSpace(query[start:]), Line: startLine})
+	}
+
+	return statements, nil
+}
+
+// isDML checks if the statement changes rows, so the number of affected rows makes sense for it.
+// Comments preceding statements are stripped by SplitStatements, so the first word is the statement keyword
+func isDML(statement string) bool {
+	switch statementKeyword(statement) {
+	case "INSERT", "UPDATE", "DELETE", "REPLACE", "MERGE", "WITH":
+		return true
+	}
+	return false
+}
+
+// isDDL checks if the statement changes the schema, engines without transactional DDL commit such statements implicitly
+func isDDL(statement string) bool {
+	switch statementKeyword(statement) {
+	case "CREATE", "ALTER", "DROP", "RENAME", "TRUNCATE":
+		return true
+	}
+	return false
+}
+
+// statementKeyword returns the first word of the statement in upper case
+func statementKeyword(statement string) string {
+	i := 0
+	for i < len(statement) && isIdentChar(statement[i]) {
+		i++
+	}
+	return strings.ToUpper(statement[:i])
+}
+
+// skipBlockComment returns the index following the block comment starting at i and the number of newlines in it
+func skipBlockComment(query string, i int, nested bool) (int, int, error) {
+	level := 0
+	lines := 0
+	for j := i; j < len(query); j++ {
+		switch {
+		case query[j] == '\n':
+			lines++
+		case query[j] == '/' && j+1 < len(query) && query[j+1] == '*' && (nested || level == 0):
+			level++
+			j++
+		case query[j] == '*' && j+1 < len(query) && query[j+1] == '/':
+			level--
+			j++
+			if level == 0 {
+				return j + 1, lines, nil
+			}
+		}
+	}
+	return 0, 0, errors.New("unterminated block comment")
+}
+
+// skipQuoted returns the index following the quoted string or identifier starting at i and the number of newlines in it,
+// doubled closing quote is treated as escaped one
+func skipQuoted(query string, i int, closing byte, backslashEscapes bool) (int, int, error) {
+	lines := 0
+	for j := i + 1; j < len(query); j++ {
+		switch {
+		case query[j] == '\n':
+			lines++
+		case query[j] == '\\' && backslashEscapes:
+			j++
+			if j < len(query) && query[j] == '\n' {
+				lines++
+			}
+		case query[j] == closing:
+			if j+1 < len(query) && query[j+1] == closing {
+				j++
+				continue
+			}
+			return j + 1, lines, nil
+		}
+	}
+	return 0, 0, errors.Errorf("unterminated %c quoted string", query[i])
+}
+
+// dollarQuoteTag returns the tag, e.g. $$ or $body$, if the dollar quoted string starts at i
+func dollarQuoteTag(query string, i int) (string, bool) {
+	j := i + 1
+	// tag follows the same rules as identifiers, so $1 is a positional parameter
+	if j < len(query) && query[j] >= '0' && query[j] <= '9' {
+		return "", false
+	}
+	for j < len(query) && isIdentChar(query[j]) && query[j] != '$' {
+		j++
+	}
+	if j < len(query) && query[j] == '$' {
+		return query[i : j+1], true
+	}
+	return "", false
+}
+
+// isEscapeStringPrefix checks if the quote at i is preceded by E, which makes postgres string an escape one
+func isEscapeStringPrefix(query string, i int) bool {
+	if i == 0 || (query[i-1] != 'E' && query[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isIdentChar(query[i-2])
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '$'
+}
+
+// hasDirective checks if the migration header, i.e. line comments at the beginning of the migration, contains the directive
+func hasDirective(query string, directive string) bool {
+	for _, line := range strings.Split(query, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			return false
+		}
+		if strings.TrimSpace(strings.TrimPrefix(line, "--")) == directive {
+			return true
+		}
+	}
+	return false
+}
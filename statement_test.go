@@ -0,0 +1,69 @@
+package dbmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SplitStatements(t *testing.T) {
+	queries := func(statements []*Statement) []string {
+		var result []string
+		for _, st := range statements {
+			result = append(result, st.Query)
+		}
+		return result
+	}
+
+	// plain statements with line numbers, comments before statements are stripped
+	statements, err := SplitStatements("CREATE TABLE posts (title TEXT);\n\n-- comment; with semicolon\nALTER TABLE posts ADD content TEXT;\n/* block; comment */", &SQLDialect{})
+	require.NoError(t, err)
+	require.Len(t, statements, 2)
+	assert.Equal(t, &Statement{Query: "CREATE TABLE posts (title TEXT)", Line: 1}, statements[0])
+	assert.Equal(t, &Statement{Query: "ALTER TABLE posts ADD content TEXT", Line: 4}, statements[1])
+
+	// last statement without semicolon
+	statements, _ = SplitStatements("DROP TABLE posts;\n DROP TABLE tags", &SQLDialect{})
+	assert.Equal(t, []string{"DROP TABLE posts", "DROP TABLE tags"}, queries(statements))
+
+	// semicolons in strings and identifiers
+	statements, _ = SplitStatements(`INSERT INTO "po;sts" (title) VALUES ('a;b''c;');`+"\nSELECT `x;y` FROM t;", &SQLDialect{})
+	assert.Equal(t, []string{`INSERT INTO "po;sts" (title) VALUES ('a;b''c;')`, "SELECT `x;y` FROM t"}, queries(statements))
+
+	// unterminated strings and comments
+	_, err = SplitStatements("SELECT 1;\nSELECT 'abc;", &SQLDialect{})
+	assert.EqualError(t, err, "line 2: unterminated ' quoted string")
+	_, err = SplitStatements("SELECT 1; /* comment", &SQLDialect{})
+	assert.EqualError(t, err, "line 1: unterminated block comment")
+
+	// CASE expressions and transaction BEGIN
+	statements, _ = SplitStatements("BEGIN;\nSELECT CASE WHEN a THEN 1 ELSE 2 END FROM t;\nCOMMIT;", &SQLDialect{})
+	assert.Equal(t, []string{"BEGIN", "SELECT CASE WHEN a THEN 1 ELSE 2 END FROM t", "COMMIT"}, queries(statements))
+}
+
+func Test_hasDirective(t *testing.T) {
+	assert.True(t, hasDirective("-- dbmigrate:no-transaction\nCREATE INDEX CONCURRENTLY idx ON posts (title);", noTransactionDirective))
+	assert.True(t, hasDirective("\n-- Adds index\n--dbmigrate:no-transaction\n\nCREATE INDEX CONCURRENTLY idx ON posts (title);", noTransactionDirective))
+	assert.False(t, hasDirective("CREATE INDEX idx ON posts (title);\n-- dbmigrate:no-transaction", noTransactionDirective))
+	assert.False(t, hasDirective("-- dbmigrate:no-transactions\nCREATE INDEX idx ON posts (title);", noTransactionDirective))
+}
+
+func Test_isDML(t *testing.T) {
+	for _, st := range []string{"INSERT INTO posts (title) VALUES ('a')", "update posts SET title = 'x'", "DELETE FROM posts",
+		"REPLACE INTO posts (title) VALUES ('a')", "WITH t AS (SELECT 1) DELETE FROM posts"} {
+		assert.True(t, isDML(st), st)
+	}
+	for _, st := range []string{"CREATE TABLE posts (title VARCHAR(255))", "DROP TABLE posts", "ALTER TABLE posts ADD body TEXT", "INSERTS", ""} {
+		assert.False(t, isDML(st), st)
+	}
+}
+
+func Test_isDDL(t *testing.T) {
+	for _, st := range []string{"CREATE TABLE posts (title VARCHAR(255))", "drop table posts", "ALTER TABLE posts ADD body TEXT", "TRUNCATE posts"} {
+		assert.True(t, isDDL(st), st)
+	}
+	for _, st := range []string{"INSERT INTO posts (title) VALUES ('a')", "SELECT 1", "CREATED", ""} {
+		assert.False(t, isDDL(st), st)
+	}
+}
@@ -0,0 +1,117 @@
+package dbmigrate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// SSL modes, they have the same meaning as postgres sslmode values
+const (
+	// SSLModeDisable disables TLS
+	SSLModeDisable = "disable"
+	// SSLModeRequire requires TLS, but doesn't verify the server certificate
+	SSLModeRequire = "require"
+	// SSLModeVerifyCA requires TLS and verifies that the server certificate is signed by the trusted CA
+	SSLModeVerifyCA = "verify-ca"
+	// SSLModeVerifyFull is the same as SSLModeVerifyCA, but also verifies that the server host name matches the certificate
+	SSLModeVerifyFull = "verify-full"
+)
+
+// checkTLSSettings returns error if TLS settings are inconsistent
+func checkTLSSettings(settings *Settings) error {
+	switch settings.SSLMode {
+	case "", SSLModeDisable, SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull:
+	default:
+		return errors.Errorf("unknown ssl mode %s, should be one of disable, require, verify-ca or verify-full", settings.SSLMode)
+	}
+
+	if (settings.SSLCert == "") != (settings.SSLKey == "") {
+		return errors.New("ssl client certificate and key should be provided together")
+	}
+
+	if settings.Engine == "sqlite" && (settings.SSLMode != "" || settings.SSLCA != "" || settings.SSLCert != "") {
+		return errors.New("ssl settings are not supported by sqlite")
+	}
+	return nil
+}
+
+// tlsConfig returns TLS client configuration built from settings, or nil if TLS is disabled.
+// The host is required by verify-full mode, because the driver connects to the default address or socket without it
+func tlsConfig(settings *Settings) (*tls.Config, error) {
+	if settings.SSLMode == "" || settings.SSLMode == SSLModeDisable {
+		return nil, nil
+	}
+	if settings.SSLMode == SSLModeVerifyFull && settings.Host == "" {
+		return nil, errors.New("host should be provided for verify-full ssl mode, its name is verified against the server certificate")
+	}
+
+	config := &tls.Config{ServerName: settings.Host}
+
+	if settings.SSLCA != "" {
+		pem, err := ioutil.ReadFile(settings.SSLCA)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read ssl CA file %s", settings.SSLCA)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("can't parse certificates of ssl CA file %s", settings.SSLCA)
+		}
+	}
+
+	if settings.SSLCert != "" {
+		cert, err := tls.LoadX509KeyPair(settings.SSLCert, settings.SSLKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't load ssl client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	switch settings.SSLMode {
+	case SSLModeRequire:
+		config.InsecureSkipVerify = true
+	case SSLModeVerifyCA:
+		// the standard verification also checks the host name, so the chain is verified manually
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertificateChain(rawCerts, config.RootCAs)
+		}
+	}
+
+	return config, nil
+}
+
+// verifyCertificateChain verifies that the server certificate is signed by one of roots, without checking the host name
+func verifyCertificateChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server provided no certificates")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return errors.Wrap(err, "can't parse server certificate")
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
+
+// tlsConfigName returns the name the TLS configuration built from settings is registered with,
+// different settings give different names, so several migrators can be used at the same time
+func tlsConfigName(settings *Settings) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00%s", settings.SSLMode, settings.SSLCA, settings.SSLCert, settings.SSLKey, settings.Host, settings.Database)
+	return fmt.Sprintf("dbmigrate-%x", h.Sum32())
+}
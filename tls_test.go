@@ -0,0 +1,85 @@
+package dbmigrate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkTLSSettings(t *testing.T) {
+	assert.NoError(t, checkTLSSettings(&Settings{Engine: "postgres", SSLMode: SSLModeVerifyFull, SSLCert: "client.crt", SSLKey: "client.key"}))
+	assert.NoError(t, checkTLSSettings(&Settings{Engine: "sqlite"}))
+	assert.EqualError(t, checkTLSSettings(&Settings{Engine: "mysql", SSLMode: "prefer"}),
+		"unknown ssl mode prefer, should be one of disable, require, verify-ca or verify-full")
+	assert.EqualError(t, checkTLSSettings(&Settings{Engine: "mysql", SSLCert: "client.crt"}), "ssl client certificate and key should be provided together")
+	assert.EqualError(t, checkTLSSettings(&Settings{Engine: "sqlite", SSLMode: SSLModeRequire}), "ssl settings are not supported by sqlite")
+}
+
+func Test_tlsConfig(t *testing.T) {
+	config, err := tlsConfig(&Settings{SSLMode: SSLModeDisable})
+	require.NoError(t, err)
+	assert.Nil(t, config)
+
+	config, err = tlsConfig(&Settings{SSLMode: SSLModeRequire, Host: "db"})
+	require.NoError(t, err)
+	assert.True(t, config.InsecureSkipVerify)
+	assert.Equal(t, "db", config.ServerName)
+
+	_, err = tlsConfig(&Settings{SSLMode: SSLModeVerifyFull, SSLCA: "nonexistent.pem", Host: "db"})
+	assert.Error(t, err)
+
+	_, err = tlsConfig(&Settings{SSLMode: SSLModeVerifyFull})
+	assert.EqualError(t, err, "host should be provided for verify-full ssl mode, its name is verified against the server certificate")
+
+	caDER := testCertificate(t)
+	caFile, err := ioutil.TempFile("", "dbmigrate-ca")
+	require.NoError(t, err)
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	caFile.Close()
+
+	config, err = tlsConfig(&Settings{SSLMode: SSLModeVerifyFull, SSLCA: caFile.Name(), Host: "db"})
+	require.NoError(t, err)
+	assert.False(t, config.InsecureSkipVerify)
+	assert.NotNil(t, config.RootCAs)
+
+	// the certificate is for localhost, but verify-ca mode doesn't check the host name
+	config, err = tlsConfig(&Settings{SSLMode: SSLModeVerifyCA, SSLCA: caFile.Name(), Host: "db"})
+	require.NoError(t, err)
+	assert.True(t, config.InsecureSkipVerify)
+	assert.NoError(t, config.VerifyPeerCertificate([][]byte{caDER}, nil))
+	assert.Error(t, config.VerifyPeerCertificate([][]byte{testCertificate(t)}, nil))
+	assert.Error(t, config.VerifyPeerCertificate(nil, nil))
+}
+
+func Test_tlsConfigName(t *testing.T) {
+	s := &Settings{SSLMode: SSLModeVerifyFull, SSLCA: "ca.pem"}
+	assert.Equal(t, tlsConfigName(s), tlsConfigName(&Settings{SSLMode: SSLModeVerifyFull, SSLCA: "ca.pem"}))
+	assert.NotEqual(t, tlsConfigName(s), tlsConfigName(&Settings{SSLMode: SSLModeVerifyFull, SSLCA: "other.pem"}))
+}
+
+// testCertificate returns DER encoded self-signed CA certificate for localhost
+func testCertificate(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "localhost"}, DNSNames: []string{"localhost"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return der
+}
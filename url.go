@@ -0,0 +1,85 @@
+package dbmigrate
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// urlEngines is the map where keys are schemes of database URLs and values are database engines names
+var urlEngines = map[string]string{
+	"postgres":   "postgres",
+	"postgresql": "postgres",
+	"mysql":      "mysql",
+	"sqlite":     "sqlite",
+	"sqlite3":    "sqlite",
+	"file":       "sqlite",
+}
+
+// applyURL fills settings, which are not set explicitly, from settings.URL,
+// query params of the URL are added to settings.Params, unless they are already there
+func applyURL(settings *Settings) error {
+	u, err := url.Parse(settings.URL)
+	if err != nil {
+		return errors.Wrap(err, "can't parse database URL")
+	}
+
+	engine, ok := urlEngines[strings.ToLower(u.Scheme)]
+	if !ok {
+		// engines registered by RegisterProvider are used as schemes of their URLs
+		if _, ok = providerByName(strings.ToLower(u.Scheme)); !ok {
+			return errors.Errorf("unsupported database URL scheme %s", u.Scheme)
+		}
+		engine = strings.ToLower(u.Scheme)
+	}
+	if settings.Engine == "" {
+		settings.Engine = engine
+	}
+	if settings.Engine != engine {
+		return errors.Errorf("database URL is for %s, but engine is %s", engine, settings.Engine)
+	}
+
+	if settings.Database == "" {
+		if engine == "sqlite" {
+			// file:test.db has the opaque path, sqlite://test.db has the host and sqlite:///tmp/test.db has the absolute path
+			settings.Database = u.Opaque
+			if settings.Database == "" {
+				settings.Database = u.Host + u.Path
+			}
+		} else {
+			settings.Database = strings.TrimPrefix(u.Path, "/")
+		}
+	}
+
+	if engine != "sqlite" {
+		if settings.User == "" {
+			settings.User = u.User.Username()
+		}
+		if password, ok := u.User.Password(); ok && settings.Password == "" {
+			settings.Password = password
+		}
+		if settings.Host == "" {
+			settings.Host = u.Hostname()
+		}
+		if port := u.Port(); port != "" && settings.Port == 0 {
+			settings.Port, err = strconv.Atoi(port)
+			if err != nil {
+				return errors.Wrapf(err, "can't parse port %s of database URL", port)
+			}
+		}
+	}
+
+	// the map is copied, so the one passed by the caller is not changed
+	params := make(map[string]string)
+	for k, values := range u.Query() {
+		params[k] = values[len(values)-1]
+	}
+	for k, v := range settings.Params {
+		params[k] = v
+	}
+	settings.Params = params
+
+	return nil
+}
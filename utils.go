@@ -1,8 +1,12 @@
 package dbmigrate
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
+	"os/user"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -48,11 +52,38 @@ func isRootDir(dir string) bool {
 	return false
 }
 
-// Engines returns list of supported database engines
+// Engines returns sorted list of supported database engines, including the ones registered by RegisterProvider
 func Engines() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
 	var engines []string
 	for engine := range providers {
 		engines = append(engines, engine)
 	}
+	sort.Strings(engines)
 	return engines
 }
+
+// checksum returns hex encoded sha256 hash of the migration file contents
+func checksum(query []byte) string {
+	hash := sha256.Sum256(query)
+	return hex.EncodeToString(hash[:])
+}
+
+// currentUser returns the name of the OS user running the process, empty if it can't be determined
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// currentHost returns the host name, empty if it can't be determined
+func currentHost() string {
+	host, _ := os.Hostname()
+	return host
+}
@@ -3,7 +3,6 @@ package dbmigrate
 import (
 	"os"
 	"path/filepath"
-	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -60,11 +59,11 @@ func Test_isRootDir(t *testing.T) {
 }
 
 func Test_Engines(t *testing.T) {
-	exp := []string{"sqlite", "postgres", "mysql"}
-	sort.Strings(exp)
-
-	act := Engines()
-	sort.Strings(act)
+	assert.Equal(t, []string{"mysql", "postgres", "sqlite"}, Engines())
+}
 
-	assert.Equal(t, exp, act)
+func Test_checksum(t *testing.T) {
+	assert.Len(t, checksum([]byte("CREATE TABLE posts;")), 64)
+	assert.Equal(t, checksum([]byte("CREATE TABLE posts;")), checksum([]byte("CREATE TABLE posts;")))
+	assert.NotEqual(t, checksum([]byte("CREATE TABLE posts;")), checksum([]byte("CREATE TABLE authors;")))
 }